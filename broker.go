@@ -0,0 +1,421 @@
+package evsrc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrSlowSubscriber is returned by Broker.Subscribe when the subscriber was
+// disconnected for falling too far behind.
+var ErrSlowSubscriber = errors.New("subscriber fell too far behind")
+
+// ErrTooManySubscribers is returned by Broker.Subscribe when the request was
+// refused for exceeding the Broker's MaxSubscribers.
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+// ResumeLostEvent is the name of the Event Broker.Subscribe sends when a
+// client resumes from a Last-Event-ID that is no longer in the Broker's Replay
+// buffer. Its Data is that Last-Event-ID. The Events published since then
+// can't be sent, so the client should refetch whatever state it builds from
+// the stream; live Events follow as usual.
+const ResumeLostEvent = "resume-lost"
+
+// defaultQueueSize is the subscriber queue size used when Broker.QueueSize is
+// zero.
+const defaultQueueSize = 64
+
+// A Broker fans out published Events to many subscribed event streams.
+//
+// Each subscriber has a queue of Events waiting to be sent to it. A subscriber
+// whose queue is full when an Event is published is disconnected rather than
+// being allowed to hold up publishing or use unbounded memory; a reconnecting
+// client can then resume from its Last-Event-ID. Subscribers whose
+// connections fail are removed.
+//
+// A Broker can be divided into namespaces, such as one per tenant of a
+// multi-tenant service, each with its own subscribers, Replay buffer, limits,
+// and Stats; see Namespace.
+//
+// Brokers are safe for concurrent use.
+type Broker struct {
+	// QueueSize is the number of Events that may wait to be sent to each
+	// subscriber. If zero, 64 is used. It must be set before the first call
+	// to Subscribe.
+	QueueSize int
+
+	// Replay, if non-nil, records every published Event, and is used to send
+	// subscribers resuming with a Last-Event-ID header the Events they
+	// missed. It must be set before the first call to Publish.
+	Replay *ReplayBuffer
+
+	// MaxEvents and MaxAge, if positive, limit the number of Events sent to a
+	// subscriber and how long a subscription lasts. Once either limit is
+	// reached, the subscriber's stream is ended cleanly, and the client
+	// reconnects and resumes from its Last-Event-ID. This spreads long-lived
+	// clients across servers as they are added, and bounds how long any
+	// connection's state can drift.
+	MaxEvents int
+	MaxAge    time.Duration
+
+	// ReconnectDelay, if positive, is sent as the retry time before ending a
+	// stream that reached MaxEvents or MaxAge, to stagger reconnections.
+	ReconnectDelay time.Duration
+
+	// Clock is used to time MaxAge. If nil, the system clock is used.
+	Clock Clock
+
+	// MaxSubscribers, if positive, limits how many requests Subscribe keeps
+	// subscribed at once. Further requests are refused with a 503 Service
+	// Unavailable status.
+	MaxSubscribers int
+
+	// ConfigureNamespace, if non-nil, is called with each namespace when
+	// Namespace creates it, before it is returned, so that it can be given
+	// its own limits or Replay buffer. It is called without the Broker's lock
+	// held, so it may use the Broker. If Namespace is called concurrently
+	// with a new name, it may be called for more than one new namespace, of
+	// which only one is kept.
+	ConfigureNamespace func(name string, ns *Broker)
+
+	mu         sync.Mutex
+	subs       map[*subscriber]struct{}
+	admitted   int
+	stats      BrokerStats
+	namespaces map[string]*Broker
+	closed     bool
+	closeCause error
+	done       chan struct{}
+}
+
+// BrokerStats counts a Broker's activity, not including that of its
+// namespaces.
+type BrokerStats struct {
+	// Subscribers is the number of current subscribers.
+	Subscribers int
+
+	// Published is the number of Events published before the Broker was
+	// closed.
+	Published int
+
+	// Dropped is the number of subscribers disconnected for falling too far
+	// behind, and Refused the number of requests refused for exceeding
+	// MaxSubscribers.
+	Dropped int
+	Refused int
+}
+
+type subscriber struct {
+	queue chan Event
+
+	// dropped is closed when the subscriber is disconnected for being slow.
+	dropped chan struct{}
+}
+
+// NewBroker returns a Broker with no subscribers.
+func NewBroker() *Broker {
+	return &Broker{
+		subs: make(map[*subscriber]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Publish sends a copy of e to every current subscriber.
+func (b *Broker) Publish(e Event) {
+	e = e.Clone()
+
+	// Compressing for the Replay buffer can be slow, so it's done before
+	// taking b.mu.
+	var entry replayEntry
+	if b.Replay != nil {
+		entry = b.Replay.prepare(e)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.stats.Published++
+
+	if b.Replay != nil {
+		b.Replay.insert(entry)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.queue <- e:
+		default:
+			delete(b.subs, sub)
+			close(sub.dropped)
+			b.stats.Dropped++
+		}
+	}
+}
+
+// Subscribe takes over w as NewServerConn does, and sends every Event
+// published from then on as the response to r. It runs until r's context is
+// done, sending fails, the subscriber falls too far behind (returning
+// ErrSlowSubscriber), or the Broker is closed (returning the cause given to
+// CloseCause, or nil). If r's context is done, its cause is returned, as given
+// by context.Cause. The caller's handler should then return to finish the
+// response.
+//
+// Subscribe also returns nil once the subscription reaches the Broker's
+// MaxEvents or MaxAge.
+//
+// If r has a Last-Event-ID header and the Broker has a Replay buffer holding
+// that Event, the Events published after it are sent first. If the Replay
+// buffer no longer holds it, a ResumeLostEvent is sent first instead.
+//
+// Requests beyond MaxSubscribers are refused with a 503 status, and Subscribe
+// returns ErrTooManySubscribers. Requests made with HTTP/1.0 are refused with
+// a 505 status, and Subscribe returns ErrHTTP10. If w can't stream, the
+// request is answered with a 500 status and the *CapabilityError from
+// NewServerConn is returned.
+func (b *Broker) Subscribe(w http.ResponseWriter, r *http.Request) error {
+	err := refuseHTTP10(w, r)
+	if err != nil {
+		return err
+	}
+
+	if !b.admit() {
+		http.Error(w, ErrTooManySubscribers.Error(), http.StatusServiceUnavailable)
+		return ErrTooManySubscribers
+	}
+	defer b.release()
+
+	conn, err := NewServerConn(w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	sub, entries, resumed, ok := b.add(lastEventID)
+	if !ok {
+		return b.closeCause
+	}
+	defer b.remove(sub)
+
+	var missed []Event
+	if resumed {
+		missed, resumed = b.Replay.decompress(entries)
+	}
+	if b.Replay != nil && lastEventID != "" && !resumed {
+		err := conn.Send(Event{Event: ResumeLostEvent, Data: []byte(lastEventID)})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send the response headers now, so the client knows it is subscribed
+	// before the first Event.
+	conn.Flush()
+
+	sent := 0
+	for _, e := range missed {
+		err := conn.Send(e)
+		if err != nil {
+			return err
+		}
+
+		sent++
+		if b.MaxEvents > 0 && sent >= b.MaxEvents {
+			return b.endStream(conn)
+		}
+	}
+
+	var expired <-chan time.Time
+	if b.MaxAge > 0 {
+		expired = clockOrSystem(b.Clock).After(b.MaxAge)
+	}
+
+	ctx := r.Context()
+	for {
+		select {
+		case e := <-sub.queue:
+			err := conn.Send(e)
+			if err != nil {
+				return err
+			}
+
+			sent++
+			if b.MaxEvents > 0 && sent >= b.MaxEvents {
+				return b.endStream(conn)
+			}
+		case <-expired:
+			return b.endStream(conn)
+		case <-sub.dropped:
+			return ErrSlowSubscriber
+		case <-b.done:
+			return b.closeCause
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// endStream finishes a subscription that reached MaxEvents or MaxAge.
+func (b *Broker) endStream(conn *ServerConn) error {
+	if b.ReconnectDelay <= 0 {
+		return nil
+	}
+	return conn.Send(Event{Retry: int(b.ReconnectDelay / time.Millisecond)})
+}
+
+// add registers a new subscriber, returning it along with the Replay entries
+// it missed since lastEventID, and whether lastEventID was found in Replay.
+// The entries are decompressed by the caller, outside b.mu.
+func (b *Broker) add(lastEventID string) (sub *subscriber, missed []replayEntry, resumed, ok bool) {
+	queueSize := b.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	sub = &subscriber{
+		queue:   make(chan Event, queueSize),
+		dropped: make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, false, false
+	}
+	b.subs[sub] = struct{}{}
+
+	// Looking up missed Events under b.mu means none can be published between
+	// the lookup and the subscriber being added, so there are no gaps or
+	// duplicates between the missed and live Events.
+	if b.Replay != nil && lastEventID != "" {
+		missed, resumed = b.Replay.since(lastEventID)
+	}
+
+	return sub, missed, resumed, true
+}
+
+// admit counts a new request for Subscribe, returning false if it would
+// exceed MaxSubscribers.
+func (b *Broker) admit() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.MaxSubscribers > 0 && b.admitted >= b.MaxSubscribers {
+		b.stats.Refused++
+		return false
+	}
+	b.admitted++
+	return true
+}
+
+func (b *Broker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.admitted--
+}
+
+func (b *Broker) remove(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
+
+// Subscribers returns the number of current subscribers.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Stats returns the Broker's current BrokerStats.
+func (b *Broker) Stats() BrokerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Subscribers = len(b.subs)
+	return stats
+}
+
+// Namespace returns the Broker for the namespace name within b, creating it
+// if needed. A namespace's subscribers only receive the Events published to
+// it, not those published to b or to other namespaces, so tenants sharing a
+// server can't see each other's Events.
+//
+// A new namespace starts with b's QueueSize, MaxEvents, MaxAge,
+// ReconnectDelay, Clock, and MaxSubscribers, and if b has a Replay buffer, an
+// empty one of the same size, before ConfigureNamespace is called. Closing b
+// closes its namespaces.
+func (b *Broker) Namespace(name string) *Broker {
+	b.mu.Lock()
+	ns, ok := b.namespaces[name]
+	b.mu.Unlock()
+	if ok {
+		return ns
+	}
+
+	ns = NewBroker()
+	ns.QueueSize = b.QueueSize
+	ns.MaxEvents = b.MaxEvents
+	ns.MaxAge = b.MaxAge
+	ns.ReconnectDelay = b.ReconnectDelay
+	ns.Clock = b.Clock
+	ns.MaxSubscribers = b.MaxSubscribers
+	if b.Replay != nil {
+		ns.Replay = b.Replay.empty()
+	}
+	if b.ConfigureNamespace != nil {
+		b.ConfigureNamespace(name, ns)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.namespaces[name]; ok {
+		// Another call created the namespace while this one configured it.
+		return existing
+	}
+	if b.closed {
+		ns.CloseCause(b.closeCause)
+	}
+
+	if b.namespaces == nil {
+		b.namespaces = make(map[string]*Broker)
+	}
+	b.namespaces[name] = ns
+	return ns
+}
+
+// Close ends every subscription, and makes later calls to Subscribe return
+// immediately. Events published after Close are discarded.
+func (b *Broker) Close() {
+	b.CloseCause(nil)
+}
+
+// CloseCause is like Close, but makes Subscribe return cause, so that
+// handlers can tell why their subscriptions ended. Only the first call to
+// Close or CloseCause has any effect. The Broker's namespaces are closed with
+// the same cause.
+func (b *Broker) CloseCause(cause error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.closeCause = cause
+	close(b.done)
+
+	for sub := range b.subs {
+		delete(b.subs, sub)
+	}
+	for _, ns := range b.namespaces {
+		ns.CloseCause(cause)
+	}
+}
@@ -0,0 +1,363 @@
+package evsrc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func waitForSubscribers(t *testing.T, b *Broker, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Broker has %v subscribers, wanted %v", b.Subscribers(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBrokerFanOut(t *testing.T) {
+	b := NewBroker()
+	subscribeErrs := make(chan error, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscribeErrs <- b.Subscribe(w, r)
+	}))
+	defer server.Close()
+
+	var clients []*ClientConn
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		client, _ := NewClientConn(bufio.NewReader(resp.Body))
+		clients = append(clients, client)
+	}
+	waitForSubscribers(t, b, 2)
+
+	want := []Event{
+		{ID: "1", Data: []byte("first")},
+		{Event: "update", ID: "2", Data: []byte("second")},
+	}
+	for _, ev := range want {
+		b.Publish(ev)
+	}
+
+	for i, client := range clients {
+		for _, w := range want {
+			ev, err := client.ReceiveOwned()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ev.Eq(w) {
+				t.Errorf("client %v got event %#v, wanted %#v", i, ev, w)
+			}
+		}
+	}
+
+	b.Close()
+	for i := 0; i < 2; i++ {
+		if err := <-subscribeErrs; err != nil {
+			t.Errorf("Subscribe returned %v after Close, wanted nil", err)
+		}
+	}
+	if b.Subscribers() != 0 {
+		t.Errorf("Broker has %v subscribers after Close", b.Subscribers())
+	}
+}
+
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	unblock chan struct{}
+}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	b.QueueSize = 1
+
+	w := blockingWriter{httptest.NewRecorder(), make(chan struct{})}
+	subscribeErr := make(chan error, 1)
+	go func() {
+		subscribeErr <- b.Subscribe(w, httptest.NewRequest("GET", "/", nil))
+	}()
+	waitForSubscribers(t, b, 1)
+
+	// The first Event blocks in Write, the second fills the queue, and the
+	// third overflows it.
+	b.Publish(Event{Data: []byte("1")})
+	time.Sleep(10 * time.Millisecond)
+	b.Publish(Event{Data: []byte("2")})
+	b.Publish(Event{Data: []byte("3")})
+
+	if b.Subscribers() != 0 {
+		t.Errorf("Broker has %v subscribers, wanted the slow one removed", b.Subscribers())
+	}
+
+	close(w.unblock)
+	if err := <-subscribeErr; err != ErrSlowSubscriber {
+		t.Errorf("Subscribe returned %v, wanted %v", err, ErrSlowSubscriber)
+	}
+}
+
+func TestBrokerCloseCause(t *testing.T) {
+	b := NewBroker()
+	cause := errors.New("shut down by operator")
+
+	subscribeErr := make(chan error, 1)
+	go func() {
+		subscribeErr <- b.Subscribe(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	waitForSubscribers(t, b, 1)
+
+	b.CloseCause(cause)
+	b.Close()
+	if err := <-subscribeErr; err != cause {
+		t.Errorf("Subscribe returned %v, wanted %v", err, cause)
+	}
+
+	err := b.Subscribe(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err != cause {
+		t.Errorf("Subscribe after close returned %v, wanted %v", err, cause)
+	}
+
+	revoked := errors.New("auth revoked")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(revoked)
+	err = NewBroker().Subscribe(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if err != revoked {
+		t.Errorf("Subscribe with a canceled context returned %v, wanted %v", err, revoked)
+	}
+}
+
+func TestBrokerReplay(t *testing.T) {
+	b := NewBroker()
+	b.Replay = NewReplayBuffer(10, 0)
+	for _, id := range []string{"1", "2", "3"} {
+		b.Publish(Event{ID: id, Data: []byte("x")})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.Subscribe(w, r)
+	}))
+	defer server.Close()
+	defer b.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitForSubscribers(t, b, 1)
+
+	b.Publish(Event{ID: "4", Data: []byte("x")})
+
+	client, _ := NewClientConn(bufio.NewReader(resp.Body))
+	for _, want := range []string{"2", "3", "4"} {
+		ev, err := client.ReceiveOwned()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.ID != want {
+			t.Errorf("Got event ID %q, wanted %q", ev.ID, want)
+		}
+	}
+}
+
+func TestBrokerResumeLost(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+	b.Replay = NewReplayBuffer(2, 0)
+	for _, id := range []string{"1", "2", "3"} {
+		b.Publish(Event{ID: id, Data: []byte("x")})
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-ID", "1")
+	subscribeErr := make(chan error, 1)
+	go func() {
+		subscribeErr <- b.Subscribe(w, r)
+	}()
+	waitForSubscribers(t, b, 1)
+	b.CloseCause(nil)
+
+	if err := <-subscribeErr; err != nil {
+		t.Fatal(err)
+	}
+	want := "event: resume-lost\ndata: 1\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+}
+
+func TestBrokerNamespace(t *testing.T) {
+	parent := NewBroker()
+	parent.Replay = NewReplayBuffer(10, 0)
+	parent.MaxSubscribers = 1
+	parent.ConfigureNamespace = func(name string, ns *Broker) {
+		if name == "big" {
+			ns.MaxSubscribers = 100
+		}
+	}
+
+	a := parent.Namespace("a")
+	if parent.Namespace("a") != a {
+		t.Errorf("Namespace returned a different Broker for the same name")
+	}
+	if a == parent.Namespace("b") || a == parent {
+		t.Errorf("Namespaces share a Broker")
+	}
+	if a.MaxSubscribers != 1 || parent.Namespace("big").MaxSubscribers != 100 {
+		t.Errorf("Namespaces were not configured from their parent and ConfigureNamespace")
+	}
+	if a.Replay == nil || a.Replay == parent.Replay {
+		t.Errorf("Namespace has Replay %p, wanted its own", a.Replay)
+	}
+
+	// Replay is per namespace, so a resume point from another is lost.
+	parent.Publish(Event{ID: "1", Data: []byte("parent")})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-ID", "1")
+	subscribeErr := make(chan error, 1)
+	go func() {
+		subscribeErr <- a.Subscribe(w, r)
+	}()
+	waitForSubscribers(t, a, 1)
+
+	refused := httptest.NewRecorder()
+	err := a.Subscribe(refused, httptest.NewRequest("GET", "/", nil))
+	if err != ErrTooManySubscribers || refused.Code != http.StatusServiceUnavailable {
+		t.Errorf("Subscribe beyond MaxSubscribers returned %v with status %v", err, refused.Code)
+	}
+
+	parent.Publish(Event{Data: []byte("parent")})
+	parent.Namespace("b").Publish(Event{Data: []byte("b")})
+	a.Publish(Event{ID: "2", Data: []byte("a")})
+
+	want := BrokerStats{Subscribers: 1, Published: 1, Refused: 1}
+	if got := a.Stats(); got != want {
+		t.Errorf("Got namespace stats %+v, wanted %+v", got, want)
+	}
+	want = BrokerStats{Published: 2}
+	if got := parent.Stats(); got != want {
+		t.Errorf("Got parent stats %+v, wanted %+v", got, want)
+	}
+
+	revoked := errors.New("tenant removed")
+	parent.CloseCause(revoked)
+	if err := <-subscribeErr; err != revoked {
+		t.Errorf("Subscribe returned %v after the parent was closed, wanted %v", err, revoked)
+	}
+	wantBody := "event: resume-lost\ndata: 1\n\nid: 2\ndata: a\n\n"
+	if got := w.Body.String(); got != wantBody {
+		t.Errorf("Got %q, wanted %q", got, wantBody)
+	}
+
+	err = parent.Namespace("later").Subscribe(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err != revoked {
+		t.Errorf("Subscribe to a namespace created after Close returned %v, wanted %v", err, revoked)
+	}
+}
+
+func TestBrokerLimits(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+	b.Replay = NewReplayBuffer(10, 0)
+	b.MaxEvents = 3
+	b.ReconnectDelay = 1500 * time.Millisecond
+	for _, id := range []string{"1", "2"} {
+		b.Publish(Event{ID: id, Data: []byte("x")})
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-ID", "1")
+	subscribeErr := make(chan error, 1)
+	go func() {
+		subscribeErr <- b.Subscribe(w, r)
+	}()
+	waitForSubscribers(t, b, 1)
+
+	// One replayed Event and two live ones reach MaxEvents.
+	for _, id := range []string{"3", "4", "5"} {
+		b.Publish(Event{ID: id, Data: []byte("x")})
+	}
+
+	if err := <-subscribeErr; err != nil {
+		t.Fatalf("Subscribe returned %v at MaxEvents, wanted nil", err)
+	}
+	want := "id: 2\ndata: x\n\nid: 3\ndata: x\n\nid: 4\ndata: x\n\nretry: 1500\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+
+	// MaxAge ends the stream even when nothing is published.
+	b.MaxEvents = 0
+	b.MaxAge = time.Minute
+	expire := make(chan time.Time)
+	b.Clock = afterClock(expire)
+
+	w = httptest.NewRecorder()
+	go func() {
+		subscribeErr <- b.Subscribe(w, httptest.NewRequest("GET", "/", nil))
+	}()
+	waitForSubscribers(t, b, 1)
+	expire <- time.Time{}
+
+	if err := <-subscribeErr; err != nil {
+		t.Fatalf("Subscribe returned %v at MaxAge, wanted nil", err)
+	}
+	if got := w.Body.String(); got != "retry: 1500\n\n" {
+		t.Errorf("Got %q after MaxAge, wanted only the retry time", got)
+	}
+}
+
+// afterClock is a Clock whose After returns the same channel every time.
+type afterClock chan time.Time
+
+func (c afterClock) Now() time.Time                         { return time.Time{} }
+func (c afterClock) After(d time.Duration) <-chan time.Time { return c }
+
+func TestBrokerConfigureNamespaceUsesBroker(t *testing.T) {
+	parent := NewBroker()
+	parent.ConfigureNamespace = func(name string, ns *Broker) {
+		// Each of these takes the parent's lock.
+		parent.Stats()
+		parent.Publish(Event{Data: []byte("created " + name)})
+		if name == "a" {
+			parent.Namespace("b")
+		}
+	}
+	defer parent.Close()
+
+	done := make(chan struct{})
+	go func() {
+		parent.Namespace("a")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Namespace deadlocked with a ConfigureNamespace using the Broker")
+	}
+
+	if parent.Namespace("b") == nil || parent.Stats().Published != 2 {
+		t.Errorf("Got stats %+v, wanted 2 Events published by ConfigureNamespace", parent.Stats())
+	}
+}
@@ -0,0 +1,94 @@
+package evsrc
+
+import (
+	"sort"
+	"sync"
+)
+
+// A Cache keeps the latest Event for each key seen in a stream, giving
+// "subscribe, then query the current state" semantics on top of a stream of
+// updates.
+//
+// Caches are safe for concurrent use.
+type Cache struct {
+	// OnChange, if non-nil, is called after every Event stored by Apply, with
+	// the Event's key and the Event it replaced (if any). It is called
+	// synchronously and must not call Apply.
+	OnChange func(key string, old, new Event, hadOld bool)
+
+	key func(Event) (string, bool)
+
+	mu     sync.RWMutex
+	values map[string]Event
+}
+
+// NewCache returns a Cache that stores Events under the key returned by key.
+// Events for which key returns false are not stored. If key is nil, Events are
+// stored under their Event name.
+func NewCache(key func(Event) (string, bool)) *Cache {
+	if key == nil {
+		key = func(e Event) (string, bool) { return e.Event, true }
+	}
+	return &Cache{key: key, values: make(map[string]Event)}
+}
+
+// Apply stores a copy of e under its key, replacing any previous Event.
+func (c *Cache) Apply(e Event) {
+	key, ok := c.key(e)
+	if !ok {
+		return
+	}
+	e = e.Clone()
+
+	c.mu.Lock()
+	old, hadOld := c.values[key]
+	c.values[key] = e
+	c.mu.Unlock()
+
+	if c.OnChange != nil {
+		c.OnChange(key, old, e, hadOld)
+	}
+}
+
+// Delete removes key from the Cache.
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+}
+
+// Get returns the latest Event stored under key. The caller must not modify
+// its Data.
+func (c *Cache) Get(key string) (Event, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.values[key]
+	return e, ok
+}
+
+// Keys returns the keys in the Cache in sorted order.
+func (c *Cache) Keys() []string {
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	c.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Fill applies every Event received from conn to the Cache until Receive
+// returns an error, which Fill returns.
+func (c *Cache) Fill(conn *ClientConn) error {
+	var ev Event
+	for {
+		var err error
+		ev, err = conn.Receive(ev.Data)
+		if err != nil {
+			return err
+		}
+		c.Apply(ev)
+	}
+}
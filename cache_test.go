@@ -0,0 +1,61 @@
+package evsrc
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCacheFill(t *testing.T) {
+	stream := "event: a\ndata: 1\n\nevent: b\ndata: 2\n\nevent: a\ndata: 3\n\n"
+	conn, err := NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	c := NewCache(nil)
+	c.OnChange = func(key string, old, new Event, hadOld bool) {
+		change := key + ":" + string(new.Data)
+		if hadOld {
+			change += " (was " + string(old.Data) + ")"
+		}
+		changes = append(changes, change)
+	}
+
+	err = c.Fill(conn)
+	if err != io.EOF {
+		t.Fatalf("Got err = %v, wanted EOF", err)
+	}
+
+	if keys := c.Keys(); strings.Join(keys, ",") != "a,b" {
+		t.Errorf("Got keys %v, wanted [a b]", keys)
+	}
+	if e, ok := c.Get("a"); !ok || string(e.Data) != "3" {
+		t.Errorf("Get(\"a\") = %#v, %v, wanted data \"3\"", e, ok)
+	}
+
+	want := "a:1,b:2,a:3 (was 1)"
+	if got := strings.Join(changes, ","); got != want {
+		t.Errorf("Got changes %#v, wanted %#v", got, want)
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Deleted key still present")
+	}
+}
+
+func TestCacheCustomKey(t *testing.T) {
+	c := NewCache(func(e Event) (string, bool) {
+		return e.ID, e.ID != ""
+	})
+
+	c.Apply(Event{ID: "x", Data: []byte("1")})
+	c.Apply(Event{Data: []byte("no key")})
+
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "x" {
+		t.Errorf("Got keys %v, wanted [x]", keys)
+	}
+}
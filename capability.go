@@ -0,0 +1,76 @@
+package evsrc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A CapabilityError reports that a ResponseWriter, and every ResponseWriter it
+// wraps, lacks something needed to stream. This usually means a middleware
+// wrapped the server's ResponseWriter without passing the capability through
+// or providing an Unwrap method.
+//
+// CapabilityErrors wrap http.ErrNotSupported.
+type CapabilityError struct {
+	// Capability is the missing method, such as "Flush".
+	Capability string
+
+	// Chain holds the types of the ResponseWriters searched for it,
+	// outermost first, as found by following Unwrap methods.
+	Chain []string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("event stream response writer does not support %s (searched %s)", e.Capability, strings.Join(e.Chain, " -> "))
+}
+
+func (e *CapabilityError) Unwrap() error {
+	return http.ErrNotSupported
+}
+
+// unwrapChain returns w followed by every ResponseWriter it wraps, found by
+// following Unwrap methods as http.ResponseController does.
+func unwrapChain(w http.ResponseWriter) []http.ResponseWriter {
+	chain := []http.ResponseWriter{w}
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return chain
+		}
+		w = u.Unwrap()
+		if w == nil {
+			return chain
+		}
+		chain = append(chain, w)
+	}
+}
+
+// requireCapability returns a *CapabilityError if no ResponseWriter in w's
+// chain satisfies has.
+func requireCapability(w http.ResponseWriter, capability string, has func(http.ResponseWriter) bool) error {
+	chain := unwrapChain(w)
+
+	var types []string
+	for _, w := range chain {
+		if has(w) {
+			return nil
+		}
+		types = append(types, fmt.Sprintf("%T", w))
+	}
+	return &CapabilityError{Capability: capability, Chain: types}
+}
+
+func canFlush(w http.ResponseWriter) bool {
+	switch w.(type) {
+	case http.Flusher, interface{ FlushError() error }:
+		return true
+	}
+	return false
+}
+
+func canSetWriteDeadline(w http.ResponseWriter) bool {
+	_, ok := w.(interface{ SetWriteDeadline(time.Time) error })
+	return ok
+}
@@ -0,0 +1,100 @@
+package evsrc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hidingWriter hides the capabilities of the ResponseWriter it wraps, as
+// careless middleware does.
+type hidingWriter struct {
+	w http.ResponseWriter
+}
+
+func (h hidingWriter) Header() http.Header         { return h.w.Header() }
+func (h hidingWriter) Write(p []byte) (int, error) { return h.w.Write(p) }
+func (h hidingWriter) WriteHeader(code int)        { h.w.WriteHeader(code) }
+
+// unwrappingWriter hides capabilities, but allows them to be found through
+// its Unwrap method.
+type unwrappingWriter struct {
+	hidingWriter
+}
+
+func (u unwrappingWriter) Unwrap() http.ResponseWriter { return u.w }
+
+func TestNewServerConnFindsWrappedFlusher(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(unwrappingWriter{hidingWriter{w}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.Send(Event{Data: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Flushed {
+		t.Errorf("Send did not flush the wrapped ResponseWriter")
+	}
+
+	err = conn.SetWriteDeadline(time.Now())
+	var capErr *CapabilityError
+	if !errors.As(err, &capErr) || capErr.Capability != "SetWriteDeadline" {
+		t.Errorf("SetWriteDeadline on a ResponseRecorder returned %v", err)
+	}
+}
+
+func TestNewServerConnReportsMissingFlusher(t *testing.T) {
+	w := httptest.NewRecorder()
+	_, err := NewServerConn(unwrappingWriter{hidingWriter{hidingWriter{w}}})
+
+	var capErr *CapabilityError
+	if !errors.As(err, &capErr) {
+		t.Fatalf("Got error %v, wanted a *CapabilityError", err)
+	}
+	if !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("CapabilityError does not wrap http.ErrNotSupported")
+	}
+	if capErr.Capability != "Flush" || len(capErr.Chain) != 2 {
+		t.Errorf("Got %#v", capErr)
+	}
+	if !strings.Contains(err.Error(), "evsrc.unwrappingWriter -> evsrc.hidingWriter") {
+		t.Errorf("Error %q does not name the ResponseWriters searched", err)
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Errorf("NewServerConn wrote to a ResponseWriter it can't stream to")
+	}
+
+	w = httptest.NewRecorder()
+	err = StreamFunc(hidingWriter{w}, httptest.NewRequest("GET", "/", nil), func(send func(Event) error) error {
+		t.Errorf("StreamFunc called fn without being able to stream")
+		return nil
+	})
+	if !errors.As(err, &capErr) {
+		t.Errorf("StreamFunc returned %v, wanted a *CapabilityError", err)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("StreamFunc responded with status %v, wanted 500", w.Code)
+	}
+}
+
+func TestEncoderSetWriteDeadline(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	enc := NewEncoder(c1)
+	err := enc.SetWriteDeadline(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(Event{Data: []byte("x")}); err == nil {
+		t.Errorf("Encode succeeded past the write deadline")
+	}
+}
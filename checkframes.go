@@ -0,0 +1,120 @@
+package evsrc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	errConcurrentSend   = errors.New("concurrent ServerConn.Send calls on the same stream")
+	errWriteOutsideSend = errors.New("write to event stream outside of ServerConn.Send")
+)
+
+// sendTracker is implemented by ResponseWriters that want to know when a
+// ServerConn starts and finishes writing an Event.
+type sendTracker interface {
+	beginSend()
+	endSend()
+}
+
+// CheckFrames wraps w so that a ServerConn created on the result checks its
+// own output, for use while developing and testing. It detects concurrent
+// calls to Send, writes to the stream that do not come from Send, and Events
+// whose output is not a single well-formed frame, such as when another writer
+// interleaves data with a Send.
+//
+// Problems are passed to report, which is called synchronously from the
+// offending Send or Write. If report is nil, CheckFrames panics instead.
+//
+// The returned ResponseWriter unwraps to w, so a ServerConn flushes and sets
+// deadlines on w (or the ResponseWriters it wraps) as it would without
+// CheckFrames, and fails in the same way if w can't. Writes that bypass the
+// returned ResponseWriter (by using w directly) cannot be detected.
+func CheckFrames(w http.ResponseWriter, report func(error)) http.ResponseWriter {
+	if report == nil {
+		report = func(err error) { panic(err) }
+	}
+	return &frameChecker{ResponseWriter: w, report: report}
+}
+
+type frameChecker struct {
+	http.ResponseWriter
+	report func(error)
+
+	mu     sync.Mutex
+	inSend bool
+	frame  []byte
+}
+
+func (c *frameChecker) beginSend() {
+	c.mu.Lock()
+	concurrent := c.inSend
+	c.inSend = true
+	c.frame = c.frame[:0]
+	c.mu.Unlock()
+
+	if concurrent {
+		c.report(errConcurrentSend)
+	}
+}
+
+func (c *frameChecker) endSend() {
+	c.mu.Lock()
+	err := checkFrame(c.frame)
+	c.inSend = false
+	c.mu.Unlock()
+
+	if err != nil {
+		c.report(err)
+	}
+}
+
+func (c *frameChecker) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	inSend := c.inSend
+	if inSend {
+		c.frame = append(c.frame, p...)
+	}
+	c.mu.Unlock()
+
+	if !inSend {
+		c.report(errWriteOutsideSend)
+	}
+
+	return c.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the checked ResponseWriter, for http.ResponseController and
+// NewServerConn. frameChecker has no Flush method of its own, so that it
+// doesn't claim capabilities the checked ResponseWriter lacks.
+func (c *frameChecker) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// checkFrame returns an error if frame is not exactly one event (or comment)
+// terminated by a blank line. Send splits Data on carriage returns as well as
+// line feeds and writes only line feeds, so a carriage return in a frame means
+// something else wrote a line break clients would see.
+func checkFrame(frame []byte) error {
+	if !bytes.HasSuffix(frame, []byte("\n\n")) {
+		return fmt.Errorf("event stream frame %q is not terminated by a blank line", frame)
+	}
+
+	lines := bytes.Split(frame[:len(frame)-2], []byte("\n"))
+	for _, line := range lines {
+		switch {
+		case len(line) == 0:
+			return fmt.Errorf("event stream frame %q contains more than one event", frame)
+		case bytes.IndexByte(line, '\r') != -1:
+			return fmt.Errorf("event stream frame %q contains a carriage return", frame)
+		case line[0] == ':':
+		case bytes.IndexByte(line, ':') <= 0:
+			return fmt.Errorf("event stream frame %q contains malformed line %q", frame, line)
+		}
+	}
+
+	return nil
+}
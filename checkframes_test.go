@@ -0,0 +1,140 @@
+package evsrc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckFramesAcceptsValidOutput(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(CheckFrames(w, func(err error) {
+		t.Errorf("Unexpected report: %v", err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ev := range []Event{Event{}, Event{Data: []byte("a\nb")}, weirdEvent} {
+		err := conn.Send(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !w.Flushed {
+		t.Errorf("CheckFrames did not pass flushes through")
+	}
+}
+
+func TestCheckFramesReportsRawWrites(t *testing.T) {
+	var reports []error
+	w := CheckFrames(httptest.NewRecorder(), func(err error) {
+		reports = append(reports, err)
+	})
+
+	_, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("data: sneaky\n\n"))
+
+	if len(reports) != 1 || reports[0] != errWriteOutsideSend {
+		t.Errorf("Got reports %v, wanted [%v]", reports, errWriteOutsideSend)
+	}
+}
+
+func TestCheckFramesReportsBadFrames(t *testing.T) {
+	frames := []string{
+		"data: carriage\rreturn\n\n",
+		"data: a\n",
+		"data: a\n\ndata: b\n\n",
+		"no colon\n\n",
+	}
+	for _, frame := range frames {
+		if checkFrame([]byte(frame)) == nil {
+			t.Errorf("checkFrame(%#v) accepted a bad frame", frame)
+		}
+	}
+}
+
+func TestCheckFramesAcceptsCarriageReturnData(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(CheckFrames(w, func(err error) {
+		t.Errorf("Unexpected report: %v", err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.Send(Event{Data: []byte("50%\r100%")})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFramesKeepsCapabilities(t *testing.T) {
+	_, err := NewServerConn(CheckFrames(hidingWriter{httptest.NewRecorder()}, nil))
+	var capErr *CapabilityError
+	if !errors.As(err, &capErr) || capErr.Capability != "Flush" {
+		t.Errorf("NewServerConn on a checked non-Flusher returned %v, wanted a *CapabilityError", err)
+	}
+
+	deadlineErr := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := NewServerConn(CheckFrames(w, nil))
+		if err != nil {
+			deadlineErr <- err
+			return
+		}
+		deadlineErr <- conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if err := <-deadlineErr; err != nil {
+		t.Errorf("SetWriteDeadline through CheckFrames returned %v", err)
+	}
+}
+
+func TestCheckFramesFlushErrors(t *testing.T) {
+	w := CheckFrames(hidingWriter{httptest.NewRecorder()}, nil)
+	err := http.NewResponseController(w).Flush()
+	if !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Flushing a checked non-Flusher returned %v, wanted http.ErrNotSupported", err)
+	}
+}
+
+func TestCheckFramesReportsConcurrentSends(t *testing.T) {
+	var reports []error
+	w := CheckFrames(httptest.NewRecorder(), func(err error) {
+		reports = append(reports, err)
+	})
+	tracker := w.(sendTracker)
+
+	tracker.beginSend()
+	tracker.beginSend()
+
+	if len(reports) != 1 || reports[0] != errConcurrentSend {
+		t.Errorf("Got reports %v, wanted [%v]", reports, errConcurrentSend)
+	}
+}
+
+func TestCheckFramesPanicsWithoutReport(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("CheckFrames did not panic")
+		}
+	}()
+
+	w := CheckFrames(httptest.NewRecorder(), nil)
+	w.Write([]byte("oops"))
+}
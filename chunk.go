@@ -0,0 +1,132 @@
+package evsrc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Event names used by SendChunked.
+const (
+	ChunkEventName    = "chunk"
+	ChunkEndEventName = "chunk-end"
+)
+
+var errChunkAfterEnd = errors.New("chunk received after chunk-end")
+
+// A ChunkManifest is sent as the JSON Data of the ChunkEndEventName Event that
+// follows the chunks of a payload sent by SendChunked.
+type ChunkManifest struct {
+	Chunks int    `json:"chunks"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"` // hex encoded
+}
+
+// SendChunked sends the contents of r as a sequence of Events named
+// ChunkEventName, each carrying up to chunkSize bytes of r encoded as
+// standard base64, followed by an Event named ChunkEndEventName carrying a
+// ChunkManifest. send is typically ServerConn.Send.
+//
+// Use a ChunkAssembler to reassemble the payload on the receiving side.
+func SendChunked(send func(Event) error, r io.Reader, chunkSize int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	h := sha256.New()
+	var manifest ChunkManifest
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			manifest.Chunks++
+			manifest.Bytes += int64(n)
+
+			data := make([]byte, base64.StdEncoding.EncodedLen(n))
+			base64.StdEncoding.Encode(data, buf[:n])
+			sendErr := send(Event{Event: ChunkEventName, Data: data})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	manifest.SHA256 = hex.EncodeToString(h.Sum(nil))
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return send(Event{Event: ChunkEndEventName, Data: data})
+}
+
+// A ChunkAssembler writes a payload sent by SendChunked to an io.Writer as its
+// chunks are received.
+type ChunkAssembler struct {
+	w    io.Writer
+	h    hash.Hash
+	got  ChunkManifest
+	done bool
+}
+
+// NewChunkAssembler returns a ChunkAssembler that writes to w.
+func NewChunkAssembler(w io.Writer) *ChunkAssembler {
+	return &ChunkAssembler{w: w, h: sha256.New()}
+}
+
+// Add processes a received Event. Events not sent by SendChunked are ignored.
+// Add returns true once the final Event has been received and the payload
+// written to the underlying io.Writer has been checked against its manifest.
+func (a *ChunkAssembler) Add(e Event) (done bool, err error) {
+	switch e.Event {
+	case ChunkEventName:
+		if a.done {
+			return false, errChunkAfterEnd
+		}
+
+		data := make([]byte, base64.StdEncoding.DecodedLen(len(e.Data)))
+		n, err := base64.StdEncoding.Decode(data, e.Data)
+		if err != nil {
+			return false, err
+		}
+		data = data[:n]
+
+		a.h.Write(data)
+		a.got.Chunks++
+		a.got.Bytes += int64(n)
+
+		_, err = a.w.Write(data)
+		return false, err
+
+	case ChunkEndEventName:
+		if a.done {
+			return false, errChunkAfterEnd
+		}
+		a.done = true
+
+		var want ChunkManifest
+		err := json.Unmarshal(e.Data, &want)
+		if err != nil {
+			return false, err
+		}
+
+		a.got.SHA256 = hex.EncodeToString(a.h.Sum(nil))
+		if a.got != want {
+			return false, fmt.Errorf("chunked payload does not match its manifest: got %+v, wanted %+v", a.got, want)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
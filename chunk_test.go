@@ -0,0 +1,63 @@
+package evsrc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChunkedRoundTrip(t *testing.T) {
+	payload := []byte(`{"big": "` + strings.Repeat("x\ny\r\n", 100) + `"}`)
+
+	var events []Event
+	err := SendChunked(func(e Event) error {
+		events = append(events, e)
+		return nil
+	}, bytes.NewReader(payload), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantEvents := (len(payload)+63)/64 + 1
+	if len(events) != wantEvents {
+		t.Errorf("Got %v events, wanted %v", len(events), wantEvents)
+	}
+
+	var out bytes.Buffer
+	a := NewChunkAssembler(&out)
+	for i, e := range events {
+		done, err := a.Add(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done != (i == len(events)-1) {
+			t.Errorf("Add returned done = %v for event %v of %v", done, i, len(events))
+		}
+	}
+
+	if !bytes.Equal(out.Bytes(), payload) {
+		t.Errorf("Reassembled payload does not match")
+	}
+}
+
+func TestChunkAssemblerDetectsMissingChunk(t *testing.T) {
+	var events []Event
+	err := SendChunked(func(e Event) error {
+		events = append(events, e)
+		return nil
+	}, strings.NewReader("abcdefghij"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewChunkAssembler(&bytes.Buffer{})
+	for i, e := range events {
+		if i == 1 {
+			continue
+		}
+		_, err = a.Add(e)
+	}
+	if err == nil {
+		t.Errorf("ChunkAssembler accepted a payload with a missing chunk")
+	}
+}
@@ -0,0 +1,263 @@
+package evsrc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRetry is the reconnection delay used when Client.Retry is zero.
+const defaultRetry = 3 * time.Second
+
+// A ResponseError is returned by Client.Run when the server responds to the
+// stream request with something other than an event stream, or to a snapshot
+// request with an unexpected status. As in the HTML5 specification, Client
+// does not reconnect after such a response, except that a snapshot request
+// answered with a 5xx status is retried like a network error.
+type ResponseError struct {
+	URL         string
+	StatusCode  int
+	ContentType string
+}
+
+func (e *ResponseError) Error() string {
+	if e.StatusCode != http.StatusOK {
+		return fmt.Sprintf("%s: got status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s: got Content-Type %q, wanted an event stream", e.URL, e.ContentType)
+}
+
+// A Client reads an event stream from a URL, reconnecting whenever the
+// connection is lost, as browsers' EventSource does. Each reconnection sends
+// the ID of the last Event received in the Last-Event-ID header, so that the
+// server can resume the stream where it left off.
+//
+// A Client must not be modified or used by another goroutine while Run is
+// running, except to call RetryInterval and Stats.
+type Client struct {
+	// URL is the URL of the event stream.
+	URL string
+
+	// HTTPClient is used to make requests. If nil, http.DefaultClient is
+	// used. Its Timeout, if any, limits the whole stream and should usually
+	// be zero.
+	HTTPClient *http.Client
+
+	// LastEventID is the ID of the last Event received. It is sent as the
+	// Last-Event-ID header, and may be set before calling Run to resume a
+	// stream from an earlier run.
+	LastEventID string
+
+	// Retry is the delay before reconnecting. If zero, three seconds is used.
+	// Once the server sends a retry field, its value is used instead.
+	Retry time.Duration
+
+	// Clock is used to wait before reconnecting and to measure Stats. If nil,
+	// the system clock is used.
+	Clock Clock
+
+	// SnapshotURL, if set, is the URL of a snapshot of the state the stream
+	// updates, which is fetched before each connection to the stream and
+	// passed to HandleSnapshot. Refetches are conditional on the ETag and
+	// Last-Modified of the previous snapshot, and a 304 Not Modified response
+	// skips HandleSnapshot, so reconnecting is cheap when the state is large
+	// but unchanged.
+	SnapshotURL string
+
+	// HandleSnapshot is called with the body of each new snapshot.
+	HandleSnapshot func(body io.Reader) error
+
+	// MaxLag and OnLag, if both set, warn that the Client is falling behind:
+	// OnLag is called with the current Stats after each Event that leaves
+	// Stats.Lag above MaxLag. Lag is only measured for streams from
+	// ServerConns with StampSendTime set.
+	MaxLag time.Duration
+	OnLag  func(Stats)
+
+	etag         string
+	lastModified string
+
+	// serverRetry is the last retry time sent by the server, in
+	// milliseconds.
+	serverRetry atomic.Int64
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// Stats returns the Stats of the Client's current connection, or of its last
+// one if it is not connected. It may be called while Run is running.
+func (c *Client) Stats() Stats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.stats
+}
+
+// RetryInterval returns the delay Run currently waits before reconnecting:
+// the retry time most recently sent by the server, or Retry if the server has
+// not sent one. It may be called while Run is running.
+func (c *Client) RetryInterval() time.Duration {
+	if ms := c.serverRetry.Load(); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	if c.Retry > 0 {
+		return c.Retry
+	}
+	return defaultRetry
+}
+
+// Run connects to the stream and calls handle with every Event received,
+// reconnecting after a delay whenever the connection fails or ends.
+//
+// Run returns nil once an Event named DoneEventName has been handled, or once
+// the server responds with 204 No Content, which are the ways servers signal
+// that a stream is finished. Otherwise it runs until ctx is done, handle
+// returns an error, or the server responds with something other than an event
+// stream (a *ResponseError), and returns that error. When ctx is done, the
+// error returned is context.Cause(ctx), so that callers who cancel ctx with a
+// cause can tell why Run stopped.
+func (c *Client) Run(ctx context.Context, handle func(Event) error) error {
+	for {
+		reconnect, err := c.connect(ctx, handle)
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if !reconnect {
+			return err
+		}
+
+		select {
+		case <-clockOrSystem(c.Clock).After(c.RetryInterval()):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// connect reads the stream over a single connection, returning whether Run
+// should reconnect afterwards.
+func (c *Client) connect(ctx context.Context, handle func(Event) error) (bool, error) {
+	if c.SnapshotURL != "" {
+		reconnect, err := c.fetchSnapshot(ctx)
+		if err != nil {
+			return reconnect, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if c.LastEventID != "" {
+		req.Header.Set("Last-Event-ID", c.LastEventID)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return false, nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if resp.StatusCode != http.StatusOK || mediaType != "text/event-stream" {
+		return false, &ResponseError{URL: c.URL, StatusCode: resp.StatusCode, ContentType: contentType}
+	}
+
+	conn, err := NewClientConn(bufio.NewReader(resp.Body))
+	if err != nil {
+		return false, err
+	}
+	conn.LastEventID = c.LastEventID
+	conn.Clock = c.Clock
+
+	for {
+		ev, err := conn.ReceiveOwned()
+		c.LastEventID = conn.LastEventID
+		if conn.Retry > 0 {
+			c.serverRetry.Store(int64(conn.Retry))
+		}
+		if err != nil {
+			return true, err
+		}
+
+		stats := conn.Stats()
+		c.statsMu.Lock()
+		c.stats = stats
+		c.statsMu.Unlock()
+
+		if c.OnLag != nil && c.MaxLag > 0 && stats.Lag > c.MaxLag {
+			c.OnLag(stats)
+		}
+
+		err = handle(ev)
+		if err != nil {
+			return false, err
+		}
+
+		if ev.IsDone() {
+			return false, nil
+		}
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// fetchSnapshot fetches SnapshotURL and handles it if it has changed,
+// returning whether Run should reconnect after an error.
+func (c *Client) fetchSnapshot(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.SnapshotURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+	if c.lastModified != "" {
+		req.Header.Set("If-Modified-Since", c.lastModified)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		// Server errors are usually transient, so they are retried.
+		retry := resp.StatusCode >= 500
+		return retry, &ResponseError{URL: c.SnapshotURL, StatusCode: resp.StatusCode}
+	}
+
+	if c.HandleSnapshot != nil {
+		err = c.HandleSnapshot(resp.Body)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	c.etag = resp.Header.Get("ETag")
+	c.lastModified = resp.Header.Get("Last-Modified")
+	return false, nil
+}
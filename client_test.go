@@ -0,0 +1,354 @@
+package evsrc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientReconnects(t *testing.T) {
+	var mu sync.Mutex
+	var lastEventIDs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("Got Accept header %q", r.Header.Get("Accept"))
+		}
+
+		conn, _ := NewServerConn(w)
+		switch r.Header.Get("Last-Event-ID") {
+		case "":
+			conn.Send(Event{ID: "1", Data: []byte("one")})
+			conn.Send(Event{ID: "2", Data: []byte("two")})
+		case "2":
+			conn.Send(Event{ID: "3", Data: []byte("three")})
+			conn.SendDone()
+		default:
+			t.Errorf("Got unexpected Last-Event-ID %q", r.Header.Get("Last-Event-ID"))
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{URL: server.URL, Retry: time.Millisecond}
+
+	var got []string
+	err := client.Run(context.Background(), func(ev Event) error {
+		got = append(got, ev.ID+"="+string(ev.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := strings.Join(got, ","); s != "1=one,2=two,3=three,=" {
+		t.Errorf("Got events %q", s)
+	}
+	if s := strings.Join(lastEventIDs, ","); s != ",2" {
+		t.Errorf("Got Last-Event-IDs %q, wanted none and then 2", s)
+	}
+	if client.LastEventID != "3" {
+		t.Errorf("Got LastEventID %q after Run, wanted 3", client.LastEventID)
+	}
+}
+
+func TestClientStops(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		handle  func(Event) error
+		check   func(error) bool
+	}{
+		{
+			"no content",
+			func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			nil,
+			func(err error) bool { return err == nil },
+		},
+		{
+			"not found",
+			http.NotFound,
+			nil,
+			func(err error) bool {
+				re, ok := err.(*ResponseError)
+				return ok && re.StatusCode == http.StatusNotFound
+			},
+		},
+		{
+			"handler error",
+			func(w http.ResponseWriter, r *http.Request) {
+				conn, _ := NewServerConn(w)
+				conn.Send(Event{Data: []byte("x")})
+			},
+			func(Event) error { return handlerErr },
+			func(err error) bool { return err == handlerErr },
+		},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(test.handler)
+
+		handle := test.handle
+		if handle == nil {
+			handle = func(ev Event) error {
+				t.Errorf("%v: got unexpected event %#v", test.name, ev)
+				return nil
+			}
+		}
+
+		client := &Client{URL: server.URL, Retry: time.Millisecond}
+		err := client.Run(context.Background(), handle)
+		if !test.check(err) {
+			t.Errorf("%v: Run returned unexpected error %v", test.name, err)
+		}
+
+		server.Close()
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The server is gone, so the Client keeps retrying until ctx is done.
+	client := &Client{URL: server.URL, Retry: time.Millisecond}
+	err := client.Run(ctx, func(Event) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("Run returned %v, wanted %v", err, context.DeadlineExceeded)
+	}
+
+	idle := errors.New("idle timeout")
+	causeCtx, cancelCause := context.WithCancelCause(context.Background())
+	time.AfterFunc(20*time.Millisecond, func() { cancelCause(idle) })
+
+	err = client.Run(causeCtx, func(Event) error { return nil })
+	if err != idle {
+		t.Errorf("Run returned %v, wanted the cancellation cause %v", err, idle)
+	}
+}
+
+func TestClientSnapshot(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		log = append(log, "snapshot If-None-Match="+r.Header.Get("If-None-Match"))
+		mu.Unlock()
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("big state"))
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := NewServerConn(w)
+		if r.Header.Get("Last-Event-ID") == "" {
+			conn.Send(Event{ID: "1", Data: []byte("update")})
+		} else {
+			conn.SendDone()
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{
+		URL:         server.URL + "/events",
+		SnapshotURL: server.URL + "/snapshot",
+		Retry:       time.Millisecond,
+		HandleSnapshot: func(body io.Reader) error {
+			data, err := io.ReadAll(body)
+			mu.Lock()
+			log = append(log, "handled "+string(data))
+			mu.Unlock()
+			return err
+		},
+	}
+	err := client.Run(context.Background(), func(ev Event) error {
+		mu.Lock()
+		log = append(log, "event "+ev.Event+string(ev.Data))
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `snapshot If-None-Match=|handled big state|event update|snapshot If-None-Match="v1"|event done`
+	if got := strings.Join(log, "|"); got != want {
+		t.Errorf("Got %q,\nwanted %q", got, want)
+	}
+}
+
+func TestClientSnapshotRetries(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			// Fails the request with a protocol error.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Write([]byte("garbage\r\n\r\n"))
+			conn.Close()
+		case 3:
+			w.Write([]byte("state"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := NewServerConn(w)
+		conn.SendDone()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	clock := &recordingClock{}
+	var snapshots []string
+	client := &Client{
+		URL:         server.URL + "/events",
+		SnapshotURL: server.URL + "/snapshot",
+		Clock:       clock,
+		HandleSnapshot: func(body io.Reader) error {
+			data, err := io.ReadAll(body)
+			snapshots = append(snapshots, string(data))
+			return err
+		},
+	}
+	err := client.Run(context.Background(), func(Event) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.afters) != 2 || len(snapshots) != 1 || snapshots[0] != "state" {
+		t.Errorf("Got snapshots %q after %v retries, wanted the state after 2", snapshots, len(clock.afters))
+	}
+
+	// Other errors are not retried.
+	err = client.Run(context.Background(), func(Event) error { return nil })
+	if re, ok := err.(*ResponseError); !ok || re.StatusCode != http.StatusNotFound {
+		t.Errorf("Run returned %v for a missing snapshot, wanted a *ResponseError with status 404", err)
+	}
+	if len(clock.afters) != 2 {
+		t.Errorf("Retried a missing snapshot")
+	}
+}
+
+type recordingClock struct {
+	mu     sync.Mutex
+	afters []time.Duration
+}
+
+func (c *recordingClock) Now() time.Time { return time.Now() }
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.afters = append(c.afters, d)
+	c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return ch
+}
+
+func TestClientHonorsRetry(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		conn, _ := NewServerConn(w)
+		switch n {
+		case 1:
+			// Disconnects without sending a retry time.
+		case 2:
+			// A retry field applies even without any data.
+			w.Write([]byte("retry: 5\n\n"))
+		default:
+			conn.SendDone()
+		}
+	}))
+	defer server.Close()
+
+	clock := &recordingClock{}
+	client := &Client{URL: server.URL, Retry: time.Second, Clock: clock}
+	if got := client.RetryInterval(); got != time.Second {
+		t.Errorf("Got RetryInterval %v before running, wanted %v", got, time.Second)
+	}
+
+	err := client.Run(context.Background(), func(Event) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Duration{time.Second, 5 * time.Millisecond}
+	if !reflect.DeepEqual(clock.afters, want) {
+		t.Errorf("Waited %v before reconnecting, wanted %v", clock.afters, want)
+	}
+	if got := client.RetryInterval(); got != 5*time.Millisecond {
+		t.Errorf("Got RetryInterval %v, wanted the server's 5ms", got)
+	}
+}
+
+func TestClientOnLag(t *testing.T) {
+	sent := time.Unix(1000, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := NewServerConn(w)
+		conn.StampSendTime = true
+		conn.Clock = fixedClock(sent)
+		conn.Send(Event{Data: []byte("x")})
+		conn.SendDone()
+	}))
+	defer server.Close()
+
+	var warnings []Stats
+	client := &Client{
+		URL:    server.URL,
+		Clock:  fixedClock(sent.Add(3 * time.Second)),
+		MaxLag: 2 * time.Second,
+		OnLag:  func(s Stats) { warnings = append(warnings, s) },
+	}
+	err := client.Run(context.Background(), func(Event) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 2 || warnings[0].Lag != 3*time.Second {
+		t.Errorf("Got lag warnings %+v, wanted two with 3s of lag", warnings)
+	}
+	if client.Stats().Events != 2 {
+		t.Errorf("Got Stats %+v, wanted 2 Events", client.Stats())
+	}
+}
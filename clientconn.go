@@ -2,18 +2,60 @@ package evsrc
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
+	"fmt"
 	"strconv"
-	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-// MaxEventDataSize is the maximum size in bytes of an Event read by ClientConn.
+// MaxEventDataSize is the default maximum size in bytes of an Event read by
+// ClientConn. See ClientConn.MaxDataSize.
 const MaxEventDataSize = 1024 * 1024 * 4
 
 var (
 	errEventDataTooBig = errors.New("event data too large")
+	errNoDeadliner     = errors.New("ClientConn has no Deadliner")
 )
 
+// Errors wrapped in StrictErrors.
+var (
+	ErrInvalidUTF8  = errors.New("line is not valid UTF-8")
+	ErrMisplacedBOM = errors.New("byte order mark after the start of the stream")
+)
+
+// A StrictError is returned by a ClientConn with Strict set when the stream
+// breaks a rule of the specification that ClientConns otherwise tolerate. Err
+// is ErrInvalidUTF8 or ErrMisplacedBOM.
+type StrictError struct {
+	// Line is the number of the offending line, counting from 1.
+	Line int64
+	Err  error
+}
+
+func (e *StrictError) Error() string {
+	return fmt.Sprintf("event stream line %d: %v", e.Line, e.Err)
+}
+
+func (e *StrictError) Unwrap() error {
+	return e.Err
+}
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// sentAtField is the extension field written by ServerConns with
+// StampSendTime set.
+const sentAtField = "sent-at"
+
+// A ReadDeadliner can bound how long reads from it block. net.Conn and
+// *os.File implement ReadDeadliner.
+type ReadDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
 // ClientConn is a low-level Event Source client API that only parses the event
 // stream.
 //
@@ -23,56 +65,206 @@ type ClientConn struct {
 	// Event didn't have any Data)
 	LastEventID string
 
+	// Retry is the last reconnection time in milliseconds received by the
+	// ClientConn (even if that Event didn't have any Data), or zero if none
+	// has been received.
+	Retry int
+
+	// Deadliner, if non-nil, is the connection underlying the bufio.Reader
+	// given to NewClientConn. It is used by ReceiveDeadline, and by ReceiveN to
+	// interrupt reads.
+	Deadliner ReadDeadliner
+
+	// DetectGzip makes the ClientConn check whether the stream starts with a
+	// gzip header, and if so, decompress it. This handles responses that were
+	// compressed but not transparently decompressed, such as when a custom
+	// http.Transport asks for gzip. It must be set before the first Receive.
+	DetectGzip bool
+
+	// OnUnknownField, if non-nil, is called with the name and value of every
+	// field the ClientConn does not recognize, so that applications can parse
+	// extensions to the format. The slices are only valid during the call.
+	OnUnknownField func(name, value []byte)
+
+	// Clock is used to timestamp activity in Stats. If nil, the system clock
+	// is used.
+	Clock Clock
+
+	// MaxDataSize is the maximum size in bytes of an Event's Data, and of any
+	// single line of the stream. Receive returns an error for Events that are
+	// too large, and skips the rest of them, up to the blank line ending them,
+	// so that the next call reads the following Event. If zero, MaxEventDataSize is used. Streams from trusted
+	// sources may need it raised, and it should be lowered when untrusted
+	// sources are expected to send only small Events.
+	MaxDataSize int
+
+	// DecodeData makes Receive decode the Data of Events compressed by a
+	// ServerConn with CompressAbove set. Otherwise, such Events are returned
+	// with their Data still encoded, and the field marking them is treated as
+	// unknown. ReceiveReader never decodes Data.
+	DecodeData bool
+
+	// Strict makes Receive return a *StrictError for streams that are not
+	// valid UTF-8 or that have a byte order mark anywhere but at the start of
+	// the stream, instead of accepting or skipping them, and makes a blank
+	// line ending fields without any data reset the event name, which
+	// otherwise carries over to the next Event. Field names are always
+	// matched case-sensitively, as the specification requires. Strict suits
+	// conformance testing and consumers that must not act on malformed input.
+	// ReceiveReader does not check the Data it streams.
+	Strict bool
+
 	br *bufio.Reader
+
+	// line holds a partial line left over from an interrupted read.
+	line []byte
+
+	// skipLF is set after a line ended with a carriage return, so that a
+	// line feed immediately following it is not taken as another line end.
+	skipLF bool
+
+	// discardLine is set while skipping the rest of a line that was too
+	// long, and discardEvent while skipping the rest of an event that was
+	// too large.
+	discardLine  bool
+	discardEvent bool
+
+	// event is the Event being built. It survives interrupted reads so that
+	// a later Receive picks up where the failed one left off.
+	event    Event
+	sentAt   time.Time
+	encoding string
+	pending  bool
+
+	// ownsData is set once the Data of a pending event has been copied out
+	// of the buffer passed to Receive.
+	ownsData bool
+
+	// stream is the data reader returned by the last ReceiveReader call, if
+	// it has not been read to the end.
+	stream *eventDataReader
+
+	// checkedGzip is set once DetectGzip has been applied.
+	checkedGzip bool
+
+	// lines is the number of lines of the stream processed so far.
+	lines int64
+
+	stats Stats
+
+	// rateStart and rateEvents track the current period for
+	// Stats.EventsPerSecond.
+	rateStart  time.Time
+	rateEvents int64
 }
 
+// lagSmoothing is the weight given to each new latency in Stats.Lag.
+const lagSmoothing = 8
+
 // NewClientConn prepares to read a stream of Events from the given bufio.Reader.
 func NewClientConn(br *bufio.Reader) (*ClientConn, error) {
-	return &ClientConn{"", br}, nil
+	return &ClientConn{br: br}, nil
 }
 
-func readFieldName(dataLeft string, r *bufio.Reader) (ok bool, err error) {
-	for i := 0; i < len(dataLeft); i++ {
-		b, err := r.ReadByte()
-		if err != nil {
-			return false, err
-		}
+// ReceiveOwned is like Receive, but the returned Event's Data is always newly
+// allocated and owned by the caller.
+func (c *ClientConn) ReceiveOwned() (Event, error) {
+	return c.Receive(nil)
+}
 
-		if b != dataLeft[i] {
-			return false, nil
-		}
+// Stats returns the counters for the stream read so far.
+func (c *ClientConn) Stats() Stats {
+	return c.stats
+}
 
-		if b == '\n' {
-			_ = r.UnreadByte()
-			return false, nil
-		}
+// ReceiveDeadline is like Receive, but gives up once deadline passes by
+// setting it as the read deadline on c.Deadliner for the duration of the call.
+// The read deadline is cleared before ReceiveDeadline returns.
+//
+// If the deadline passes, the error returned by Deadliner's reads is returned
+// (for net.Conns, errors.Is(err, os.ErrDeadlineExceeded) is true). Any partial
+// Event read so far is kept, and the next call to Receive or ReceiveDeadline
+// continues it; buf is ignored in that case.
+func (c *ClientConn) ReceiveDeadline(buf []byte, deadline time.Time) (Event, error) {
+	if c.Deadliner == nil {
+		return Event{}, errNoDeadliner
 	}
 
-	b, err := r.ReadByte()
+	err := c.Deadliner.SetReadDeadline(deadline)
 	if err != nil {
-		return false, err
+		return Event{}, err
 	}
 
-	if b != ':' {
-		_ = r.UnreadByte()
-		return false, nil
+	ev, err := c.Receive(buf)
+
+	clearErr := c.Deadliner.SetReadDeadline(time.Time{})
+	if err == nil && clearErr != nil {
+		return Event{}, clearErr
 	}
 
-	b, err = r.ReadByte()
-	if err != nil {
-		return false, err
+	return ev, err
+}
+
+// aLongTimeAgo is a read deadline that has always passed, used to interrupt
+// blocked reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// ReceiveN reads n Events, or if n <= 0, Events until a terminal one. Either
+// way, it stops early after receiving a terminal Event: one named
+// DoneEventName or ErrorEventName, which is included in the result. This suits
+// request/response exchanges, where a stream answers a single request and then
+// ends. The returned Events are owned by the caller, as with ReceiveOwned.
+//
+// If ctx is done before then, ReceiveN returns the Events received so far and
+// context.Cause(ctx). Blocked reads can only be interrupted if Deadliner is set;
+// otherwise ctx is only checked between Events. As with ReceiveDeadline, a
+// partially read Event is continued by the next call to a Receive method.
+func (c *ClientConn) ReceiveN(ctx context.Context, n int) ([]Event, error) {
+	if c.Deadliner != nil {
+		interrupted := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			defer close(interrupted)
+			c.Deadliner.SetReadDeadline(aLongTimeAgo)
+		})
+		defer func() {
+			if !stop() {
+				<-interrupted
+			}
+			c.Deadliner.SetReadDeadline(time.Time{})
+		}()
 	}
 
-	if b != ' ' {
-		_ = r.UnreadByte()
+	var events []Event
+	for n <= 0 || len(events) < n {
+		if ctx.Err() != nil {
+			return events, context.Cause(ctx)
+		}
+
+		ev, err := c.ReceiveOwned()
+		if err != nil {
+			if ctx.Err() != nil {
+				return events, context.Cause(ctx)
+			}
+			return events, err
+		}
+
+		events = append(events, ev)
+		if ev.IsDone() || ev.Event == ErrorEventName {
+			break
+		}
 	}
 
-	return true, nil
+	return events, nil
 }
 
 // Receive reads an Event from the connection. The buf argument, if non-nil, is
 // reused for the event's Data field.
 //
+// The returned Event's Data aliases buf. Passing the same buffer (or the Data
+// of a previously returned Event) to a later call invalidates the Data of
+// every Event that shared it; use Event.Clone or ReceiveOwned to keep an Event
+// past the next call.
+//
 // The semantics of Receive match the HTML5 specification, where Receive is
 // defined to return when an event is dispatched.
 //
@@ -88,165 +280,391 @@ func readFieldName(dataLeft string, r *bufio.Reader) (ok bool, err error) {
 //         }
 //         process(ev)
 //     }
+//
+// The cmd/receivecheck command reports common ways of keeping such an Event
+// past the next call.
 func (c *ClientConn) Receive(buf []byte) (Event, error) {
 	// Intended to mostly match the HTML5 specification section
 	// "Interpreting an event stream". Deviations from the spec are clearly
 	// marked in comments.
 
-	var event Event
-	if buf != nil {
-		event.Data = buf[:0]
+	err := c.start()
+	if err != nil {
+		return Event{}, err
+	}
+
+	if !c.pending {
+		c.event = Event{}
+		c.sentAt = time.Time{}
+		c.encoding = ""
+		c.ownsData = false
+		if buf != nil {
+			c.event.Data = buf[:0]
+		}
+		c.pending = true
 	}
 
 	for {
-		b, err := c.br.ReadByte()
+		line, err := c.readLine()
 		if err != nil {
-			return event, err
+			c.detachData()
+			return Event{}, err
 		}
 
-		switch b {
-		case '\n':
-			// Dispatch event
+		dispatch, err := c.processLine(line)
+		if err != nil {
+			c.pending = false
+			return Event{}, err
+		}
 
-			if len(event.Data) == 0 {
-				continue
+		if dispatch {
+			if c.encoding != "" {
+				c.pending = false
+				data, err := decodeData(c.encoding, c.event.Data, c.maxDataSize())
+				if err != nil {
+					return Event{}, err
+				}
+				c.event.Data = data
 			}
+			c.dispatched()
+			c.pending = false
+			return c.event, nil
+		}
+	}
+}
 
-			if event.Data[len(event.Data)-1] == '\n' {
-				event.Data = event.Data[:len(event.Data)-1]
-			}
-			return event, nil
+// detachData copies the Data of the pending event out of the caller's buffer,
+// since the call that continues the event may pass a different buffer, or
+// none for ReceiveOwned, and the caller is free to reuse its buffer in the
+// meantime.
+func (c *ClientConn) detachData() {
+	if c.ownsData || c.event.Data == nil {
+		return
+	}
+	c.event.Data = append(make([]byte, 0, len(c.event.Data)), c.event.Data...)
+	c.ownsData = true
+}
 
-		case 'e':
-			// Should only be /event: ?/
-			ok, err := readFieldName("vent", c.br)
+// dispatched updates the Stats for a received Event.
+func (c *ClientConn) dispatched() {
+	now := clockOrSystem(c.Clock).Now()
+
+	if !c.sentAt.IsZero() {
+		latency := now.Sub(c.sentAt)
+		c.stats.LastLatency = latency
+		if c.stats.Lag == 0 {
+			c.stats.Lag = latency
+		} else {
+			c.stats.Lag += (latency - c.stats.Lag) / lagSmoothing
+		}
+	}
+
+	c.stats.Events++
+
+	if c.rateStart.IsZero() {
+		c.rateStart = now
+	}
+	c.rateEvents++
+	if elapsed := now.Sub(c.rateStart); elapsed >= time.Second {
+		c.stats.EventsPerSecond = float64(c.rateEvents) / elapsed.Seconds()
+		c.rateStart = now
+		c.rateEvents = 0
+	}
+}
+
+// start prepares the ClientConn for reading the next Event.
+func (c *ClientConn) start() error {
+	if c.DetectGzip && !c.checkedGzip {
+		c.checkedGzip = true
+
+		magic, err := c.br.Peek(2)
+		if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+			gz, err := gzip.NewReader(c.br)
 			if err != nil {
-				return event, err
-			}
-			if !ok {
-				break
+				return err
 			}
+			c.br = bufio.NewReader(gz)
+		}
+	}
+
+	return c.finishStream()
+}
+
+// readLine returns the next line from the stream without its terminator,
+// which may be a CR, LF, or CRLF pair, skipping the rest of any event that was
+// too large. The returned slice is only valid until the next call to readLine.
+func (c *ClientConn) readLine() ([]byte, error) {
+	for {
+		line, err := c.readStreamLine()
+		if err != nil || !c.discardEvent {
+			return line, err
+		}
 
-			// TODO: Is it reasonable to reuse strings here to lessen GC pressure?
-			eventName, err := c.br.ReadString('\n')
+		c.lines++
+		if len(line) == 0 {
+			c.discardEvent = false
+		}
+	}
+}
+
+// readStreamLine returns the next line from the stream, as readLine does,
+// without skipping any.
+func (c *ClientConn) readStreamLine() ([]byte, error) {
+	err := c.skipPendingLF()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if c.br.Buffered() == 0 {
+			// Keep what we have, so that an interrupted read (such as one
+			// hitting a deadline) can be continued later.
+			_, err := c.br.Peek(1)
 			if err != nil {
-				return event, err
+				return nil, err
 			}
-			_ = c.br.UnreadByte()
+		}
+		buf, _ := c.br.Peek(c.br.Buffered())
 
-			event.Event = strings.TrimSuffix(eventName, "\n")
+		end := bytes.IndexAny(buf, "\r\n")
+		if end == -1 {
+			c.br.Discard(len(buf))
+			c.countRead(len(buf))
 
-		case 'd':
-			// Should only be /data: ?/
-			ok, err := readFieldName("ata", c.br)
-			if err != nil {
-				return event, err
+			if c.discardLine {
+				continue
 			}
-			if !ok {
-				break
+			if len(c.line)+len(buf) > c.maxDataSize() {
+				// Skip the rest of the line as it arrives, rather than
+				// reading it as a line of its own.
+				c.line = c.line[:0]
+				c.discardLine = true
+				return nil, c.tooLarge()
 			}
+			c.line = append(c.line, buf...)
+			continue
+		}
 
-			// DEVIATION FROM SPEC: We allow non-UTF-8 here.
+		// A CR may be the last byte read so far, so the LF of a CRLF pair
+		// is skipped when the next line is read rather than now.
+		c.skipLF = buf[end] == '\r'
 
-			isPrefix := true
-			for isPrefix {
-				var data []byte
-				data, isPrefix, err = c.br.ReadLine()
-				if err != nil {
-					return event, err
-				}
-				event.Data = append(event.Data, data...)
-				if len(event.Data)+len(data) >= MaxEventDataSize {
-					return event, errEventDataTooBig
-				}
-			}
-			event.Data = append(event.Data, '\n')
-			_ = c.br.UnreadByte()
+		// Discarding doesn't overwrite the buffer, so buf stays valid until
+		// the next read.
+		c.br.Discard(end + 1)
+		c.countRead(end + 1)
 
-		case 'i':
-			// Should only be /id: ?/
-			ok, err := readFieldName("d", c.br)
+		if c.discardLine {
+			c.discardLine = false
+			err := c.skipPendingLF()
 			if err != nil {
-				return event, err
-			}
-			if !ok {
-				break
+				return nil, err
 			}
+			continue
+		}
+		if len(c.line)+end > c.maxDataSize() {
+			c.line = c.line[:0]
+			return nil, c.tooLarge()
+		}
 
-			id, err := c.br.ReadString('\n')
-			if err != nil {
-				return event, err
-			}
-			_ = c.br.UnreadByte()
+		if len(c.line) == 0 {
+			return buf[:end], nil
+		}
 
-			id = strings.TrimSuffix(id, "\n")
+		c.line = append(c.line, buf[:end]...)
+		line := c.line
+		c.line = c.line[:0]
+		return line, nil
+	}
+}
 
-			c.LastEventID = id
-			event.ID = id
+// skipPendingLF consumes the LF of a CRLF pair whose CR ended the last line.
+func (c *ClientConn) skipPendingLF() error {
+	if !c.skipLF {
+		return nil
+	}
 
-		case 'r':
-			// Should only be /retry: ?/
-			ok, err := readFieldName("etry", c.br)
-			if err != nil {
-				return event, err
-			}
-			if !ok {
-				break
-			}
+	p, err := c.br.Peek(1)
+	if err != nil {
+		return err
+	}
 
-			retryStr, err := c.br.ReadString('\n')
-			if err != nil {
-				return event, err
-			}
-			_ = c.br.UnreadByte()
+	c.skipLF = false
+	if p[0] == '\n' {
+		c.br.Discard(1)
+		c.countRead(1)
+	}
+	return nil
+}
 
-			retry64, err := strconv.ParseInt(strings.TrimSuffix(retryStr, "\n"), 10, 0)
-			if err != nil {
-				break
-			}
+// tooLarge abandons the event being read, so that its remaining lines are
+// skipped rather than read as the start of another event, and returns
+// errEventDataTooBig.
+func (c *ClientConn) tooLarge() error {
+	c.pending = false
+	c.discardEvent = true
+	return errEventDataTooBig
+}
 
-			event.Retry = int(retry64)
+func (c *ClientConn) maxDataSize() int {
+	if c.MaxDataSize <= 0 {
+		return MaxEventDataSize
+	}
+	return c.MaxDataSize
+}
 
-		case 0xEF:
-			// DEVIATION FROM SPEC:
-			// UTF-8 BOM start, allowed ONCE at the start of the stream. So that
-			// we track less state, we allow it after any newline as well.
+func (c *ClientConn) countRead(n int) {
+	if n > 0 {
+		c.stats.Bytes += int64(n)
+		c.stats.LastActivity = clockOrSystem(c.Clock).Now()
+	}
+}
 
-			b, err := c.br.ReadByte()
-			if err != nil {
-				return event, err
-			}
-			if b != 0xBB {
-				break
-			}
+// processLine interprets a single line of the stream, returning true if the
+// event being built should be dispatched.
+func (c *ClientConn) processLine(line []byte) (bool, error) {
+	line, err := c.startLine(line)
+	if err != nil {
+		return false, err
+	}
 
-			b, err = c.br.ReadByte()
-			if err != nil {
-				return event, err
-			}
-			if b != 0xBF {
-				break
-			}
+	if len(line) == 0 {
+		// Dispatch event
 
-			// NB: Do not fall through to line eater below, repeat the read.
-			continue
+		if len(c.event.Data) == 0 {
+			c.skipEmptyEvent()
+			return false, nil
+		}
 
-		case ':':
-		default:
-			// Some unknown field, ignore this line
+		if c.event.Data[len(c.event.Data)-1] == '\n' {
+			c.event.Data = c.event.Data[:len(c.event.Data)-1]
 		}
+		return true, nil
+	}
 
-		// Invariant: all non-terminating cases in the switch statement above
-		// do not consume the newline, and may or may not consume extra garbage
-		// before the newline.
+	name, value := splitField(line)
+	return false, c.processField(name, value)
+}
 
-		// Consume data up to and including the next newline.
-		isPrefix := true
-		for isPrefix {
-			_, isPrefix, err = c.br.ReadLine()
-			if err != nil {
-				return event, err
+// skipEmptyEvent handles a blank line ending fields without any data, which
+// dispatches nothing.
+func (c *ClientConn) skipEmptyEvent() {
+	c.sentAt = time.Time{}
+	c.encoding = ""
+	if c.Strict {
+		c.event.Event = ""
+	}
+}
+
+// startLine counts a line of the stream, checks it if Strict is set, and
+// removes a UTF-8 byte order mark from its start.
+func (c *ClientConn) startLine(line []byte) ([]byte, error) {
+	c.lines++
+
+	// DEVIATION FROM SPEC:
+	// UTF-8 BOM start, allowed ONCE at the start of the stream. So that
+	// we track less state, we allow it at the start of any line as well,
+	// unless Strict is set.
+	if bytes.HasPrefix(line, utf8BOM) {
+		line = line[len(utf8BOM):]
+		if c.lines > 1 {
+			if c.Strict {
+				return nil, &StrictError{Line: c.lines, Err: ErrMisplacedBOM}
 			}
+			c.stats.MidStreamBOMs++
+			c.stats.ParseWarnings++
+		}
+	}
+
+	if c.Strict && !utf8.Valid(line) {
+		return nil, &StrictError{Line: c.lines, Err: ErrInvalidUTF8}
+	}
+	return line, nil
+}
+
+// splitField splits a non-empty line into its field name and value. Comment
+// lines have an empty name.
+func splitField(line []byte) (name, value []byte) {
+	colon := bytes.IndexByte(line, ':')
+	if colon == -1 {
+		// A line without a colon is a field name with an empty value.
+		return line, nil
+	}
+
+	value = line[colon+1:]
+	if len(value) > 0 && value[0] == ' ' {
+		value = value[1:]
+	}
+	return line[:colon], value
+}
+
+// processField applies a single field to the event being built.
+func (c *ClientConn) processField(name, value []byte) error {
+	switch string(name) {
+	case "":
+		// Comment
+		c.stats.Comments++
+
+	case "event":
+		c.event.Event = string(value)
+
+	case "data":
+		// DEVIATION FROM SPEC: We allow non-UTF-8 here, unless Strict
+		// is set.
+
+		if len(c.event.Data)+len(value) >= c.maxDataSize() {
+			return c.tooLarge()
+		}
+		c.event.Data = append(c.event.Data, value...)
+		c.event.Data = append(c.event.Data, '\n')
+
+	case "id":
+		id := string(value)
+		c.LastEventID = id
+		c.event.ID = id
+
+	case "retry":
+		retry64, err := strconv.ParseInt(string(value), 10, 0)
+		if err != nil {
+			c.stats.InvalidRetries++
+			c.stats.ParseWarnings++
+			break
+		}
+
+		c.event.Retry = int(retry64)
+		c.Retry = int(retry64)
+
+	case sentAtField:
+		ms, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			break
+		}
+
+		c.sentAt = time.Unix(0, ms*int64(time.Millisecond))
+
+	case contentTypeField:
+		c.event.ContentType = string(value)
+
+	case encodingField:
+		if !c.DecodeData {
+			c.unknownField(name, value)
+			break
 		}
+
+		c.encoding = string(value)
+
+	default:
+		c.unknownField(name, value)
+	}
+
+	return nil
+}
+
+func (c *ClientConn) unknownField(name, value []byte) {
+	// Some unknown field, ignore this line
+	c.stats.UnknownFields++
+	c.stats.ParseWarnings++
+	if c.OnUnknownField != nil {
+		c.OnUnknownField(name, value)
 	}
 }
@@ -3,15 +3,25 @@ package evsrc
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func (e1 Event) Eq(e2 Event) bool {
 	return e1.Event == e2.Event &&
 		bytes.Equal(e1.Data, e2.Data) &&
 		e1.ID == e2.ID &&
-		e1.Retry == e2.Retry
+		e1.Retry == e2.Retry &&
+		e1.ContentType == e2.ContentType
 }
 
 func testClientConnConsumption(t *testing.T, buf []byte, want []Event) {
@@ -89,6 +99,42 @@ func TestClientConnDataConcat(t *testing.T) {
 		})
 }
 
+func TestClientConnLineTerminators(t *testing.T) {
+	want := []Event{
+		Event{Event: "a", Data: []byte("1\n2")},
+		Event{Data: []byte("3"), ID: "x"},
+		Event{Data: []byte("\n")},
+	}
+
+	streams := []string{
+		"event:a\r\ndata:1\r\ndata:2\r\n\r\nid:x\r\ndata:3\r\n\r\ndata\r\ndata\r\n\r\n",
+		"event:a\rdata:1\rdata:2\r\rid:x\rdata:3\r\rdata\rdata\r\r",
+		"event:a\ndata:1\rdata:2\r\n\nid:x\rdata:3\n\r\ndata\r\ndata\n\r",
+	}
+	for _, stream := range streams {
+		testClientConnConsumption(t, []byte(stream), want)
+
+		// Reading one byte at a time leaves each CR at the end of a read,
+		// before the LF that may follow it has arrived.
+		client, err := NewClientConn(bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(stream)), 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, wantEvent := range want {
+			got, err := client.ReceiveOwned()
+			if err != nil {
+				t.Fatalf("Reading %#v: %v", stream, err)
+			}
+			if !got.Eq(wantEvent) {
+				t.Errorf("Got %#v from %#v, wanted %#v", got, stream, wantEvent)
+			}
+		}
+		if _, err := client.ReceiveOwned(); err != io.EOF {
+			t.Errorf("Got error %v at the end of %#v, wanted io.EOF", err, stream)
+		}
+	}
+}
+
 func TestClientConnID(t *testing.T) {
 	testClientConnConsumption(t,
 		[]byte("id: zzz\ndata: 4\n\n"),
@@ -247,3 +293,513 @@ func BenchmarkClientReads(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func TestClientConnReceiveOwned(t *testing.T) {
+	client, err := NewClientConn(bufio.NewReader(bytes.NewReader([]byte("data:1\n\ndata:2\n\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(first.Data) != "1" || string(second.Data) != "2" {
+		t.Errorf("Got data %#v and %#v, wanted \"1\" and \"2\"", string(first.Data), string(second.Data))
+	}
+}
+
+func TestEventClone(t *testing.T) {
+	orig := Event{Event: "a", Data: []byte("data"), ID: "b", Retry: 1}
+	clone := orig.Clone()
+	if !clone.Eq(orig) {
+		t.Errorf("Got clone %#v, wanted %#v", clone, orig)
+	}
+
+	orig.Data[0] = 'X'
+	if string(clone.Data) != "data" {
+		t.Errorf("Clone shares Data with the original")
+	}
+
+	if (Event{}).Clone().Data != nil {
+		t.Errorf("Clone of nil Data is non-nil")
+	}
+	if (Event{Data: []byte{}}).Clone().Data == nil {
+		t.Errorf("Clone of empty Data is nil")
+	}
+}
+
+func TestClientConnReceiveDeadline(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	defer conn.Close()
+
+	client, err := NewClientConn(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Deadliner = conn
+
+	write := func(s string) {
+		go func() {
+			_, err := server.Write([]byte(s))
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	write("id: 1\ndata: hel")
+	_, err = client.ReceiveDeadline(nil, time.Now().Add(50*time.Millisecond))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Got err = %v, wanted a deadline error", err)
+	}
+
+	write("lo\n\n")
+	event, err := client.ReceiveDeadline(nil, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Event{ID: "1", Data: []byte("hello")}
+	if !event.Eq(want) {
+		t.Errorf("Got event %#v, but wanted %#v", event, want)
+	}
+}
+
+func TestClientConnReceiveDeadlineResumeOwnsData(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	defer conn.Close()
+
+	client, err := NewClientConn(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Deadliner = conn
+
+	go server.Write([]byte("data: hel"))
+	buf := make([]byte, 0, 64)
+	_, err = client.ReceiveDeadline(buf, time.Now().Add(50*time.Millisecond))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Got err = %v, wanted a deadline error", err)
+	}
+
+	// The caller may reuse its buffer after a failed read.
+	copy(buf[:cap(buf)], "XXXXXXXX")
+
+	go server.Write([]byte("lo\n\n"))
+	event, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(event.Data) != "hello" {
+		t.Errorf("Got Data %#v, wanted \"hello\"", string(event.Data))
+	}
+	if &event.Data[0] == &buf[:1][0] {
+		t.Errorf("ReceiveOwned returned Data aliasing the buffer of an earlier call")
+	}
+}
+
+func TestClientConnReceiveN(t *testing.T) {
+	client, err := NewClientConn(bufio.NewReader(bytes.NewBufferString(
+		"data: 1\n\ndata: 2\n\ndata: 3\n\nevent: done\ndata:\n\ndata: 4\n\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.ReceiveN(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || string(events[0].Data) != "1" || string(events[1].Data) != "2" {
+		t.Errorf("Got events %#v, wanted the first two", events)
+	}
+
+	// Stops at the done Event, even though more were asked for.
+	events, err = client.ReceiveN(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || string(events[0].Data) != "3" || !events[1].IsDone() {
+		t.Errorf("Got events %#v, wanted 3 and the done Event", events)
+	}
+
+	events, err = client.ReceiveN(context.Background(), 0)
+	if err != io.EOF {
+		t.Errorf("Got err = %v, wanted %v", err, io.EOF)
+	}
+	if len(events) != 1 || string(events[0].Data) != "4" {
+		t.Errorf("Got events %#v, wanted only 4", events)
+	}
+}
+
+func TestClientConnReceiveNCancel(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	defer conn.Close()
+
+	client, err := NewClientConn(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Deadliner = conn
+
+	go server.Write([]byte("data: 1\n\ndata: par"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	events, err := client.ReceiveN(ctx, 0)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Got err = %v, wanted %v", err, context.DeadlineExceeded)
+	}
+	if len(events) != 1 || string(events[0].Data) != "1" {
+		t.Errorf("Got events %#v, wanted only 1", events)
+	}
+
+	// The deadline is cleared and the partial Event is kept.
+	go server.Write([]byte("tial\n\n"))
+	event, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(event.Data) != "partial" {
+		t.Errorf("Got event %#v, wanted Data partial", event)
+	}
+}
+
+func TestClientConnReceiveDeadlineWithoutDeadliner(t *testing.T) {
+	client, err := NewClientConn(bufio.NewReader(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.ReceiveDeadline(nil, time.Now())
+	if err != errNoDeadliner {
+		t.Errorf("Got err = %v, wanted %v", err, errNoDeadliner)
+	}
+}
+
+func TestClientConnFieldWithoutColon(t *testing.T) {
+	testClientConnConsumption(t,
+		[]byte("data\n\nevent\ndata:a\ndata\ndata:b\n\n"),
+		[]Event{
+			Event{Data: []byte{}},
+			Event{Data: []byte("a\n\nb")},
+		})
+
+	// A bare "id" clears the last event ID, and a bare "event" resets the
+	// name to the default.
+	client, err := NewClientConn(bufio.NewReader(strings.NewReader(
+		"id: 5\nevent: a\ndata: x\n\nid\nevent: b\nevent\ndata: y\n\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != "5" || first.Event != "a" {
+		t.Errorf("Got first event %#v", first)
+	}
+	second, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != "" || second.Event != "" || client.LastEventID != "" {
+		t.Errorf("Got second event %#v and LastEventID %#v, wanted both cleared", second, client.LastEventID)
+	}
+}
+
+func TestClientConnOnUnknownField(t *testing.T) {
+	client, err := NewClientConn(bufio.NewReader(bytes.NewReader(
+		[]byte("x-trace: abc\nflag\ndata: 1\n\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	client.OnUnknownField = func(name, value []byte) {
+		got = append(got, string(name)+"="+string(value))
+	}
+
+	event, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(event.Data) != "1" {
+		t.Errorf("Got data %#v, wanted \"1\"", string(event.Data))
+	}
+
+	want := []string{"x-trace=abc", "flag="}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Got unknown fields %v, wanted %v", got, want)
+	}
+}
+
+func TestClientConnDetectGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("data: squeezed\n\n"))
+	gz.Close()
+
+	for _, detect := range []bool{false, true} {
+		client, err := NewClientConn(bufio.NewReader(bytes.NewReader(compressed.Bytes())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.DetectGzip = detect
+
+		ev, err := client.Receive(nil)
+		if detect {
+			if err != nil || string(ev.Data) != "squeezed" {
+				t.Errorf("Got %#v, %v with DetectGzip, wanted data \"squeezed\"", ev, err)
+			}
+		} else if err == nil {
+			t.Errorf("Got event %#v from gzip data without DetectGzip", ev)
+		}
+	}
+
+	client, err := NewClientConn(bufio.NewReader(bytes.NewReader([]byte("data: plain\n\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.DetectGzip = true
+	ev, err := client.Receive(nil)
+	if err != nil || string(ev.Data) != "plain" {
+		t.Errorf("Got %#v, %v from uncompressed data with DetectGzip, wanted data \"plain\"", ev, err)
+	}
+}
+
+func TestClientConnStats(t *testing.T) {
+	stream := "\xEF\xBB\xBF:keepalive\n\ndata:1\nbogus:x\nretry:nope\n\n\xEF\xBB\xBFdata:2\n\n"
+	client, err := NewClientConn(bufio.NewReader(bytes.NewReader([]byte(stream))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		_, err := client.Receive(nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := client.Stats()
+	if stats.Events != 2 {
+		t.Errorf("Got %v events, wanted 2", stats.Events)
+	}
+	if stats.Bytes != int64(len(stream)) {
+		t.Errorf("Got %v bytes, wanted %v", stats.Bytes, len(stream))
+	}
+	if stats.Comments != 1 {
+		t.Errorf("Got %v comments, wanted 1", stats.Comments)
+	}
+	if stats.ParseWarnings != 3 {
+		t.Errorf("Got %v parse warnings, wanted 3", stats.ParseWarnings)
+	}
+	if stats.UnknownFields != 1 {
+		t.Errorf("Got %v unknown fields, wanted 1", stats.UnknownFields)
+	}
+	if stats.InvalidRetries != 1 {
+		t.Errorf("Got %v invalid retries, wanted 1", stats.InvalidRetries)
+	}
+	if stats.MidStreamBOMs != 1 {
+		t.Errorf("Got %v mid-stream BOMs, wanted 1", stats.MidStreamBOMs)
+	}
+	if stats.LastActivity.IsZero() {
+		t.Errorf("LastActivity was not set")
+	}
+}
+
+func TestClientConnMaxDataSize(t *testing.T) {
+	stream := "data: " + strings.Repeat("x", 20) + "\n\n"
+
+	client, _ := NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+	client.MaxDataSize = 10
+	_, err := client.Receive(nil)
+	if err != errEventDataTooBig {
+		t.Errorf("Got err = %v with a 10 byte limit, wanted %v", err, errEventDataTooBig)
+	}
+
+	// Lines longer than the bufio.Reader's buffer are limited too.
+	client, _ = NewClientConn(bufio.NewReaderSize(strings.NewReader(stream), 16))
+	client.MaxDataSize = 18
+	_, err = client.Receive(nil)
+	if err != errEventDataTooBig {
+		t.Errorf("Got err = %v with a long line, wanted %v", err, errEventDataTooBig)
+	}
+
+	client, _ = NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+	client.MaxDataSize = 30
+	event, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Data) != 20 {
+		t.Errorf("Got %v bytes of Data, wanted 20", len(event.Data))
+	}
+}
+
+func TestClientConnMaxDataSizeSkipsEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		size   int
+	}{
+		// Lines that fit in the bufio.Reader's buffer are limited too.
+		{"short line", "event: " + strings.Repeat("x", 1000) + "\ndata: a\n\n", 4096},
+		// The rest of a line too long for the buffer must not be read as a
+		// line of its own.
+		{"continued line", strings.Repeat("x", 32) + "data: injected\n\n", 16},
+		{"continued line with CRLF", strings.Repeat("x", 31) + "\r\ndata: injected\r\n\r\n", 16},
+		{"large data", "data: " + strings.Repeat("x", 50) + "\ndata: injected\n\n", 4096},
+	}
+
+	for _, test := range tests {
+		stream := test.stream + "data: next\n\n"
+		client, _ := NewClientConn(bufio.NewReaderSize(strings.NewReader(stream), test.size))
+		client.MaxDataSize = 20
+
+		_, err := client.Receive(nil)
+		if err != errEventDataTooBig {
+			t.Errorf("%v: got err = %v, wanted %v", test.name, err, errEventDataTooBig)
+		}
+
+		ev, err := client.Receive(nil)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if string(ev.Data) != "next" || ev.Event != "" {
+			t.Errorf("%v: got %#v after the large event, wanted the next event", test.name, ev)
+		}
+	}
+}
+
+func TestClientConnLagAndThroughput(t *testing.T) {
+	var stream bytes.Buffer
+	for i := 0; i < 10; i++ {
+		// Sent every 100ms from t=0.
+		fmt.Fprintf(&stream, "sent-at: %d\ndata: x\n\n", 1000000+i*100)
+	}
+
+	clock := &steppingClock{}
+	client, _ := NewClientConn(bufio.NewReader(&stream))
+	client.Clock = clock
+
+	for i := 0; i < 10; i++ {
+		// Received every 200ms from t=0, falling further behind each time.
+		clock.now = time.Unix(1000, 0).Add(time.Duration(i) * 200 * time.Millisecond)
+		_, err := client.Receive(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stats := client.Stats()
+		wantLatency := time.Duration(i) * 100 * time.Millisecond
+		if stats.LastLatency != wantLatency {
+			t.Errorf("Got LastLatency %v for event %v, wanted %v", stats.LastLatency, i, wantLatency)
+		}
+		if stats.Lag > wantLatency || i > 1 && stats.Lag == 0 {
+			t.Errorf("Got Lag %v for event %v, wanted it between 0 and %v", stats.Lag, i, wantLatency)
+		}
+	}
+
+	// The first second held 6 events, at 0 through 1000ms.
+	if got := client.Stats().EventsPerSecond; got != 6 {
+		t.Errorf("Got EventsPerSecond %v, wanted 6", got)
+	}
+}
+
+func TestClientConnStrict(t *testing.T) {
+	tests := []struct {
+		stream string
+		err    error
+		line   int64
+	}{
+		{"\xEF\xBB\xBFdata: ok\n\n", nil, 0},
+		{"data: ok\n\xEF\xBB\xBFdata: bom\n\n", ErrMisplacedBOM, 2},
+		{"data: ok\n\ndata: \xff\n\n", ErrInvalidUTF8, 3},
+		{"event: \xc3\x28\ndata: x\n\n", ErrInvalidUTF8, 1},
+		{"Data: case\n\n", nil, 0},
+	}
+
+	for _, test := range tests {
+		client, err := NewClientConn(bufio.NewReader(strings.NewReader(test.stream)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Strict = true
+
+		for err == nil {
+			_, err = client.ReceiveOwned()
+		}
+
+		var strictErr *StrictError
+		if test.err == nil {
+			if err != io.EOF {
+				t.Errorf("Got error %v from %#v, wanted io.EOF", err, test.stream)
+			}
+			continue
+		}
+		if !errors.As(err, &strictErr) || !errors.Is(err, test.err) || strictErr.Line != test.line {
+			t.Errorf("Got error %v from %#v, wanted %v on line %v", err, test.stream, test.err, test.line)
+		}
+	}
+
+	// Without Strict, the same streams are accepted.
+	for _, test := range tests {
+		client, err := NewClientConn(bufio.NewReader(strings.NewReader(test.stream)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for err == nil {
+			_, err = client.ReceiveOwned()
+		}
+		if err != io.EOF {
+			t.Errorf("Got error %v from %#v without Strict", err, test.stream)
+		}
+	}
+}
+
+func TestClientConnStrictResetsEventName(t *testing.T) {
+	stream := "event: a\nid: 1\n\ndata: b\n\n"
+
+	for _, strict := range []bool{false, true} {
+		client, _ := NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+		client.Strict = strict
+		ev, err := client.ReceiveOwned()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The ID is kept either way, since the specification keeps the last
+		// event ID until another is sent.
+		want := Event{Event: "a", ID: "1", Data: []byte("b")}
+		if strict {
+			want.Event = ""
+		}
+		if !ev.Eq(want) {
+			t.Errorf("Got %#v with Strict %v, wanted %#v", ev, strict, want)
+		}
+
+		client, _ = NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+		client.Strict = strict
+		header, _, err := client.ReceiveReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Event != want.Event {
+			t.Errorf("Got event name %#v from ReceiveReader with Strict %v, wanted %#v", header.Event, strict, want.Event)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package evsrc
+
+import (
+	"time"
+)
+
+// A Clock tells the time and waits for it to pass. Types in this package that
+// depend on time have a Clock field, which defaults to the system clock when
+// nil, so that tests can control time instead of sleeping. See evtest.Clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return systemClock{}
+	}
+	return c
+}
@@ -0,0 +1,333 @@
+// Command receivecheck reports Events from evsrc.ClientConn.Receive that are
+// kept past the next call to Receive without being cloned.
+//
+// Usage:
+//
+//	receivecheck [dir ...]
+//
+// Each dir is a package directory; "dir/..." also checks every package below
+// it. With no arguments, the package in the current directory is checked.
+//
+// When Receive is given a buffer to reuse, the returned Event's Data is
+// overwritten by a later call, so keeping the Event is a bug unless it is
+// copied with Event.Clone first, or read with ReceiveOwned instead. Like go
+// vet, receivecheck looks for common forms of the mistake rather than proving
+// its absence: an Event (or its Data) from such a call that is appended to a
+// slice, sent on a channel, stored in a map, slice, field, or pointer, or
+// assigned to a variable declared outside the loop the call is in. Calls whose
+// buffer is nil allocate new Data each time, and are not reported.
+//
+// receivecheck exits with status 1 if it reports anything, and 2 if a package
+// can't be read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [dir ...]\n", os.Args[0])
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	dirs, err := expandDirs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	status := 0
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		findings, err := checkDir(fset, dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+		for _, f := range findings {
+			fmt.Println(f)
+			if status == 0 {
+				status = 1
+			}
+		}
+	}
+	os.Exit(status)
+}
+
+// expandDirs expands arguments ending in "/..." to the directories below
+// them that hold Go files, skipping those go build would ignore.
+func expandDirs(args []string) ([]string, error) {
+	var dirs []string
+	for _, arg := range args {
+		root, recursive := strings.CutSuffix(arg, "/...")
+		if !recursive {
+			dirs = append(dirs, arg)
+			continue
+		}
+
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			name := info.Name()
+			if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if matches, _ := filepath.Glob(filepath.Join(path, "*.go")); len(matches) > 0 {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// checkDir checks the packages in dir, including its tests.
+func checkDir(fset *token.FileSet, dir string) ([]string, error) {
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []string
+	for _, name := range names {
+		var files []*ast.File
+		for _, f := range pkgs[name].Files {
+			files = append(files, f)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Pos() < files[j].Pos() })
+
+		findings = append(findings, checkFiles(fset, dir, files)...)
+	}
+	return findings, nil
+}
+
+// checkFiles type checks files as a package and returns its findings. Type
+// errors are ignored, since the rest of the package can still be checked.
+func checkFiles(fset *token.FileSet, dir string, files []*ast.File) []string {
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	conf.Check(dir, fset, files, info)
+
+	c := &checker{fset: fset, info: info}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Body != nil {
+					c.checkFunc(n.Body)
+				}
+				return false
+			case *ast.FuncLit:
+				c.checkFunc(n.Body)
+				return false
+			}
+			return true
+		})
+	}
+	return c.findings
+}
+
+type checker struct {
+	fset     *token.FileSet
+	info     *types.Info
+	findings []string
+}
+
+// A received is a variable assigned an Event from Receive with a buffer.
+type received struct {
+	// loop is the innermost loop containing the Receive call, if any.
+	loop ast.Node
+}
+
+// checkFunc checks a function body. Function literals inside it are checked
+// along with it, since they commonly capture the Event.
+func (c *checker) checkFunc(body *ast.BlockStmt) {
+	vars := make(map[types.Object]received)
+
+	var loops []ast.Node
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ForStmt:
+			if n.Init != nil {
+				ast.Inspect(n.Init, visit)
+			}
+			loops = append(loops, n)
+			if n.Post != nil {
+				ast.Inspect(n.Post, visit)
+			}
+			ast.Inspect(n.Body, visit)
+			loops = loops[:len(loops)-1]
+			return false
+
+		case *ast.RangeStmt:
+			loops = append(loops, n)
+			ast.Inspect(n.Body, visit)
+			loops = loops[:len(loops)-1]
+			return false
+
+		case *ast.AssignStmt:
+			if len(n.Rhs) == 1 && len(n.Lhs) >= 1 && c.isReceiveWithBuffer(n.Rhs[0]) {
+				if obj := c.object(n.Lhs[0]); obj != nil {
+					var r received
+					if len(loops) > 0 {
+						r.loop = loops[len(loops)-1]
+					}
+					vars[obj] = r
+				}
+			}
+		}
+		return true
+	}
+	ast.Inspect(body, visit)
+
+	if len(vars) == 0 {
+		return
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if id, ok := n.Fun.(*ast.Ident); ok && id.Name == "append" && c.isBuiltin(id) {
+				args := n.Args[1:]
+				if n.Ellipsis.IsValid() {
+					// append(b, ev.Data...) copies the Data.
+					args = args[:len(args)-1]
+				}
+				for _, arg := range args {
+					c.report(vars, arg, "appended")
+				}
+			}
+
+		case *ast.SendStmt:
+			c.report(vars, n.Value, "sent on a channel")
+
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				rhs := n.Rhs[i]
+				switch lhs := ast.Unparen(lhs).(type) {
+				case *ast.IndexExpr, *ast.SelectorExpr, *ast.StarExpr:
+					c.report(vars, rhs, "stored")
+				case *ast.Ident:
+					obj := c.object(lhs)
+					if obj == nil || n.Tok == token.DEFINE && c.info.Defs[lhs] != nil {
+						continue
+					}
+					if r, ok := c.tracked(vars, rhs); ok && r.loop != nil && obj.Pos() < r.loop.Pos() {
+						c.report(vars, rhs, "kept in "+lhs.Name)
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// isReceiveWithBuffer reports whether e calls ClientConn.Receive with a
+// buffer other than nil.
+func (c *checker) isReceiveWithBuffer(e ast.Expr) bool {
+	call, ok := ast.Unparen(e).(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	s, ok := c.info.Selections[sel]
+	if !ok || s.Kind() != types.MethodVal || s.Obj().Name() != "Receive" {
+		return false
+	}
+
+	// Matching the package by name also covers the evsrc package itself,
+	// which is checked under its directory rather than its import path.
+	recv := s.Recv()
+	if p, ok := recv.(*types.Pointer); ok {
+		recv = p.Elem()
+	}
+	named, ok := recv.(*types.Named)
+	if !ok || named.Obj().Name() != "ClientConn" || named.Obj().Pkg() == nil || named.Obj().Pkg().Name() != "evsrc" {
+		return false
+	}
+
+	return !c.info.Types[call.Args[0]].IsNil()
+}
+
+func (c *checker) isBuiltin(id *ast.Ident) bool {
+	_, ok := c.info.Uses[id].(*types.Builtin)
+	return ok
+}
+
+func (c *checker) object(e ast.Expr) types.Object {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return nil
+	}
+	if obj := c.info.Defs[id]; obj != nil {
+		return obj
+	}
+	return c.info.Uses[id]
+}
+
+// tracked reports whether e is a received Event or its Data.
+func (c *checker) tracked(vars map[types.Object]received, e ast.Expr) (received, bool) {
+	e = ast.Unparen(e)
+	if sel, ok := e.(*ast.SelectorExpr); ok && sel.Sel.Name == "Data" {
+		e = sel.X
+	}
+	obj := c.object(e)
+	if obj == nil {
+		return received{}, false
+	}
+	r, ok := vars[obj]
+	return r, ok
+}
+
+func (c *checker) report(vars map[types.Object]received, e ast.Expr, how string) {
+	if _, ok := c.tracked(vars, e); !ok {
+		return
+	}
+	pos := c.fset.Position(e.Pos())
+	c.findings = append(c.findings, fmt.Sprintf("%v: Event from Receive with a reused buffer is %s without Clone; its Data is overwritten by the next Receive", pos, how))
+}
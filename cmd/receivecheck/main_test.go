@@ -0,0 +1,84 @@
+package main
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const source = `package p
+
+import (
+	"bufio"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+type holder struct{ ev evsrc.Event }
+
+func bad(conn *evsrc.ClientConn, ch chan evsrc.Event, h *holder, m map[int][]byte) {
+	var events []evsrc.Event
+	var last evsrc.Event
+	var ev evsrc.Event
+	var err error
+	for i := 0; ; i++ {
+		ev, err = conn.Receive(ev.Data)
+		if err != nil {
+			return
+		}
+		events = append(events, ev) // appended
+		ch <- ev                    // sent
+		h.ev = ev                   // stored in a field
+		m[i] = ev.Data              // stored in a map
+		last = ev                   // kept outside the loop
+	}
+	_, _ = events, last
+}
+
+func good(conn *evsrc.ClientConn, ch chan evsrc.Event) {
+	var events []evsrc.Event
+	var data []byte
+	var ev evsrc.Event
+	var err error
+	for {
+		ev, err = conn.Receive(ev.Data)
+		if err != nil {
+			break
+		}
+		events = append(events, ev.Clone())
+		data = append(data, ev.Data...)
+		copied := ev
+		_ = copied
+
+		owned, _ := conn.Receive(nil)
+		ch <- owned
+	}
+	_, _ = events, data
+	_ = bufio.NewReader
+}
+`
+
+func TestCheckDir(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(source), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := checkDir(token.NewFileSet(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines := []string{":21:", ":22:", ":23:", ":24:", ":25:"}
+	if len(findings) != len(wantLines) {
+		t.Fatalf("Got findings:\n%v\nwanted one on each of lines %v", strings.Join(findings, "\n"), wantLines)
+	}
+	for i, f := range findings {
+		if !strings.Contains(f, wantLines[i]) {
+			t.Errorf("Got finding %q, wanted one on line %v", f, wantLines[i])
+		}
+	}
+}
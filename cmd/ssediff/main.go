@@ -0,0 +1,121 @@
+// Command ssediff compares two event streams and reports how the second
+// diverges from the first.
+//
+// Usage:
+//
+//	ssediff [-window n] [-for duration] a b
+//
+// Each of a and b is either a file containing a recorded event stream or an
+// http(s) URL to read a live stream from. Live streams are read until they end
+// or the -for duration passes. ssediff exits with status 1 if the streams
+// diverge.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+func main() {
+	window := flag.Int("window", 0, "how far matched events may move before being reported as reordered")
+	duration := flag.Duration("for", 10*time.Second, "how long to read live streams for")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-window n] [-for duration] a b\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	type result struct {
+		events []evsrc.Event
+		err    error
+	}
+	results := make([]chan result, 2)
+	for i, source := range flag.Args() {
+		results[i] = make(chan result, 1)
+		go func(source string, out chan<- result) {
+			events, err := readSource(ctx, source)
+			out <- result{events, err}
+		}(source, results[i])
+	}
+
+	var streams [2][]evsrc.Event
+	for i, ch := range results {
+		r := <-ch
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(i), r.err)
+			os.Exit(2)
+		}
+		streams[i] = r.events
+	}
+
+	divergences := evsrc.Diff(streams[0], streams[1], *window)
+	for _, d := range divergences {
+		fmt.Println(d)
+	}
+
+	if len(divergences) > 0 {
+		os.Exit(1)
+	}
+}
+
+func readSource(ctx context.Context, source string) ([]evsrc.Event, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequest("GET", source, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("got response status %v", resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	conn, err := evsrc.NewClientConn(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
+	var events []evsrc.Event
+	for {
+		ev, err := conn.ReceiveOwned()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return events, nil
+			}
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
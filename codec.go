@@ -0,0 +1,124 @@
+package evsrc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+)
+
+// A Codec converts values to and from Event Data.
+//
+// Marshaled data is sent as-is by ServerConn.Send, so it must not contain
+// carriage returns; binary encodings should be wrapped in base64 or similar.
+type Codec interface {
+	// ContentType returns the MIME type of the encoding, such as
+	// "application/json".
+	ContentType() string
+
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values with encoding/json.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// Base64Codec wraps a binary Codec, such as one for msgpack or CBOR, so that
+// its output is standard base64 encoded and safe to send as Event Data. Its
+// content type is the wrapped Codec's with ";base64" appended.
+func Base64Codec(c Codec) Codec {
+	return base64Codec{c}
+}
+
+type base64Codec struct {
+	c Codec
+}
+
+func (b base64Codec) ContentType() string {
+	return b.c.ContentType() + ";base64"
+}
+
+func (b base64Codec) Marshal(v interface{}) ([]byte, error) {
+	raw, err := b.c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+	base64.StdEncoding.Encode(data, raw)
+	return data, nil
+}
+
+func (b base64Codec) Unmarshal(data []byte, v interface{}) error {
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(raw, data)
+	if err != nil {
+		return err
+	}
+	return b.c.Unmarshal(raw[:n], v)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		JSONCodec.ContentType(): JSONCodec,
+	}
+)
+
+// RegisterCodec makes c available from LookupCodec under its content type,
+// replacing any Codec previously registered for it. JSONCodec is registered by
+// default.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.ContentType()] = c
+}
+
+// unregisterCodec removes the Codec registered for contentType, if any.
+func unregisterCodec(contentType string) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	delete(codecs, contentType)
+}
+
+// LookupCodec returns the Codec registered for contentType, if any.
+func LookupCodec(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[contentType]
+	return c, ok
+}
+
+// EncodeEvent returns an Event named name whose Data is v encoded with c, and
+// whose ContentType is c's.
+func EncodeEvent(c Codec, name string, v interface{}) (Event, error) {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Event: name, Data: data, ContentType: c.ContentType()}, nil
+}
+
+// Decode decodes e's Data into v using c.
+func (e Event) Decode(c Codec, v interface{}) error {
+	return c.Unmarshal(e.Data, v)
+}
+
+// Codec returns the Codec registered for e's ContentType, if any.
+func (e Event) Codec() (Codec, bool) {
+	if e.ContentType == "" {
+		return nil, false
+	}
+	return LookupCodec(e.ContentType)
+}
+
+// UnmarshalData decodes e's Data as JSON into v. It is shorthand for
+// e.Decode(JSONCodec, v).
+func (e Event) UnmarshalData(v interface{}) error {
+	return e.Decode(JSONCodec, v)
+}
@@ -0,0 +1,393 @@
+// Package cbor provides evsrc Codecs for CBOR (RFC 8949), a binary encoding
+// that is more compact than JSON, for streams where bandwidth matters.
+//
+// Event Data is text, so the encoding can be sent in two ways: Base64, which
+// any client can read, and Raw, which deviates from the event stream format
+// by sending the bytes nearly as they are, and only works between clients and
+// servers that both use this package. Importing the package registers both
+// with evsrc.RegisterCodec.
+//
+// Values are converted as encoding/json converts them, with struct fields
+// named by "cbor" tags instead of "json" ones.
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/encryptio/go-evsrc"
+	"github.com/encryptio/go-evsrc/codec/internal/codecutil"
+)
+
+// ContentType is the MIME type of CBOR data.
+const ContentType = "application/cbor"
+
+var (
+	// Base64 sends base64 encoded CBOR, with the content type
+	// "application/cbor;base64".
+	Base64 = evsrc.Base64Codec(binaryCodec{})
+
+	// Raw sends CBOR with only carriage returns escaped (0x0d as 0x1b 'r',
+	// and 0x1b as 0x1b 0x1b), with the content type "application/cbor;raw".
+	// The result is usually not valid UTF-8, so browsers and strict clients
+	// can't read it, but it is a quarter smaller than Base64.
+	Raw evsrc.Codec = rawCodec{}
+)
+
+func init() {
+	evsrc.RegisterCodec(Base64)
+	evsrc.RegisterCodec(Raw)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) ContentType() string                        { return ContentType }
+func (binaryCodec) Marshal(v interface{}) ([]byte, error)      { return Marshal(v) }
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error { return Unmarshal(data, v) }
+
+type rawCodec struct{}
+
+func (rawCodec) ContentType() string { return ContentType + ";raw" }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return codecutil.Escape(data), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	data, err := codecutil.Unescape(data)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, v)
+}
+
+// Marshal returns the CBOR encoding of v. Strings, arrays, and maps are
+// encoded with definite lengths.
+func Marshal(v interface{}) ([]byte, error) {
+	g, err := codecutil.FromGo(v, "cbor")
+	if err != nil {
+		return nil, err
+	}
+	return encode(nil, g), nil
+}
+
+// Unmarshal decodes the CBOR data item in data into the value pointed to by v.
+// Tags are ignored, so tagged items decode as their content, and undefined
+// decodes as nil.
+func Unmarshal(data []byte, v interface{}) error {
+	d := decoder{data: data}
+	g, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if len(d.data) > 0 {
+		return errTrailingData
+	}
+	return codecutil.ToGo(g, v, "cbor")
+}
+
+var (
+	errTrailingData = errors.New("cbor: data after the end of the data item")
+	errTruncated    = errors.New("cbor: data ends in the middle of a data item")
+	errBreak        = errors.New("cbor: unexpected break")
+)
+
+// The major types of data items.
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// indefinite is the additional information of indefinite length items and of
+// the break that ends them.
+const indefinite = 31
+
+func encode(b []byte, g interface{}) []byte {
+	switch g := g.(type) {
+	case nil:
+		return append(b, 0xf6)
+	case bool:
+		if g {
+			return append(b, 0xf5)
+		}
+		return append(b, 0xf4)
+
+	case int64:
+		if g < 0 {
+			return encodeHead(b, majorNegInt, uint64(^g))
+		}
+		return encodeHead(b, majorUint, uint64(g))
+	case uint64:
+		return encodeHead(b, majorUint, g)
+
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xfa), math.Float32bits(g))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(g))
+
+	case string:
+		b = encodeHead(b, majorText, uint64(len(g)))
+		return append(b, g...)
+	case []byte:
+		b = encodeHead(b, majorBytes, uint64(len(g)))
+		return append(b, g...)
+
+	case []interface{}:
+		b = encodeHead(b, majorArray, uint64(len(g)))
+		for _, e := range g {
+			b = encode(b, e)
+		}
+		return b
+	case codecutil.Map:
+		b = encodeHead(b, majorMap, uint64(len(g)))
+		for _, p := range g {
+			b = encode(b, p.Key)
+			b = encode(b, p.Value)
+		}
+		return b
+	}
+
+	panic(fmt.Sprintf("cbor: unexpected generic value %T", g))
+}
+
+// encodeHead appends the initial byte of a data item with the given major
+// type and argument, followed by the argument if it doesn't fit in the initial
+// byte.
+func encodeHead(b []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(b, major|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(b, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), arg)
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)) {
+		return nil, errTruncated
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+// head reads the initial byte of a data item and its argument. For
+// indefinite length items, the argument is zero.
+func (d *decoder) head() (major, info byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		b, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	case info == indefinite:
+		if major == majorUint || major == majorNegInt || major == majorTag {
+			break
+		}
+		return major, info, 0, nil
+	}
+
+	return 0, 0, 0, fmt.Errorf("cbor: invalid additional information %d", info)
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > codecutil.MaxDepth {
+		return nil, codecutil.ErrTooDeep
+	}
+
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return codecutil.Uint(arg), nil
+	case majorNegInt:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: negative integer -1-%d overflows int64", arg)
+		}
+		return ^int64(arg), nil
+
+	case majorBytes, majorText:
+		var s []byte
+		if info == indefinite {
+			s, err = d.chunks(major)
+		} else {
+			s, err = d.next(arg)
+			s = append([]byte(nil), s...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if major == majorText {
+			return string(s), nil
+		}
+		return s, nil
+
+	case majorArray:
+		if info == indefinite {
+			var list []interface{}
+			for !d.atBreak() {
+				e, err := d.value(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, e)
+			}
+			if list == nil {
+				list = []interface{}{}
+			}
+			return list, nil
+		}
+
+		// Every element takes at least a byte, so a longer array is
+		// truncated, and shouldn't be allocated.
+		if arg > uint64(len(d.data)) {
+			return nil, errTruncated
+		}
+		list := make([]interface{}, arg)
+		for i := range list {
+			list[i], err = d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+
+	case majorMap:
+		m := codecutil.Map{}
+		if info != indefinite {
+			if arg > uint64(len(d.data))/2 {
+				return nil, errTruncated
+			}
+			m = make(codecutil.Map, 0, arg)
+		}
+		for i := uint64(0); ; i++ {
+			if info == indefinite && d.atBreak() || info != indefinite && i == arg {
+				break
+			}
+
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			e, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, codecutil.Pair{Key: k, Value: e})
+		}
+		return m, nil
+
+	case majorTag:
+		return d.value(depth + 1)
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfToFloat(uint16(arg)), nil
+	case 26:
+		return math.Float32frombits(uint32(arg)), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case indefinite:
+		return nil, errBreak
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", arg)
+}
+
+// atBreak reports whether the next byte is the break ending an indefinite
+// length item, consuming it if so.
+func (d *decoder) atBreak() bool {
+	if len(d.data) > 0 && d.data[0] == 0xff {
+		d.data = d.data[1:]
+		return true
+	}
+	return false
+}
+
+// chunks reads the definite length chunks of an indefinite length byte or
+// text string, up to its break.
+func (d *decoder) chunks(major byte) ([]byte, error) {
+	s := []byte{}
+	for !d.atBreak() {
+		m, info, arg, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || info == indefinite {
+			return nil, errors.New("cbor: invalid chunk in indefinite length string")
+		}
+		chunk, err := d.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, chunk...)
+	}
+	return s, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float to a float64.
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,147 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+// Examples from RFC 8949, Appendix A.
+var examples = []struct {
+	hex  string
+	want interface{}
+}{
+	{"00", int64(0)},
+	{"17", int64(23)},
+	{"1818", int64(24)},
+	{"1903e8", int64(1000)},
+	{"1b000000e8d4a51000", int64(1000000000000)},
+	{"1bffffffffffffffff", uint64(18446744073709551615)},
+	{"20", int64(-1)},
+	{"3903e7", int64(-1000)},
+	{"f90000", 0.0},
+	{"f93c00", 1.0},
+	{"f97bff", 65504.0},
+	{"f90001", 5.960464477539063e-8},
+	{"f9c400", -4.0},
+	{"fa47c35000", float32(100000.0)},
+	{"fb3ff199999999999a", 1.1},
+	{"f4", false},
+	{"f5", true},
+	{"f6", nil},
+	{"f7", nil},
+	{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+	{"4401020304", []byte{1, 2, 3, 4}},
+	{"60", ""},
+	{"6449455446", "IETF"},
+	{"62c3bc", "ü"},
+	{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+	{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+	{"a26161016162820203", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+	{"7f657374726561646d696e67ff", "streaming"},
+	{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+	{"bf61610161629f0203ffff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+}
+
+func TestUnmarshalExamples(t *testing.T) {
+	for _, ex := range examples {
+		data, _ := hex.DecodeString(ex.hex)
+		var got interface{}
+		err := Unmarshal(data, &got)
+		if err != nil {
+			t.Errorf("Unmarshal(%v) returned %v", ex.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, ex.want) {
+			t.Errorf("Unmarshal(%v) = %#v, wanted %#v", ex.hex, got, ex.want)
+		}
+	}
+
+	var f float64
+	data, _ := hex.DecodeString("f97e00")
+	if err := Unmarshal(data, &f); err != nil || !math.IsNaN(f) {
+		t.Errorf("Unmarshal of a half-precision NaN got %v, %v", f, err)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{0, "00"},
+		{uint8(24), "1818"},
+		{1000000000000, "1b000000e8d4a51000"},
+		{-1000, "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{nil, "f6"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]int{1, 2, 3}, "83010203"},
+		{map[string]interface{}{"b": []int{2, 3}, "a": 1}, "a26161016162820203"},
+	}
+	for _, test := range tests {
+		data, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v) returned %v", test.v, err)
+			continue
+		}
+		if got := hex.EncodeToString(data); got != test.want {
+			t.Errorf("Marshal(%#v) = %v, wanted %v", test.v, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	for _, s := range []string{"", "18", "62c3", "83", "9f01", "ff", "0000", "1c", "bb00000000ffffffff"} {
+		data, _ := hex.DecodeString(s)
+		var v interface{}
+		if err := Unmarshal(data, &v); err == nil {
+			t.Errorf("Unmarshal(%v) succeeded with %#v", s, v)
+		}
+	}
+}
+
+type update struct {
+	ID    string   `cbor:"id"`
+	Count int      `cbor:"n,omitempty"`
+	Tags  []string `cbor:"tags"`
+	Raw   []byte
+	Skip  int `cbor:"-"`
+}
+
+func TestCodecs(t *testing.T) {
+	if c, ok := evsrc.LookupCodec("application/cbor;base64"); !ok || c != Base64 {
+		t.Errorf("Base64 is not registered")
+	}
+	if c, ok := evsrc.LookupCodec("application/cbor;raw"); !ok || c != Raw {
+		t.Errorf("Raw is not registered")
+	}
+
+	// 13 is a carriage return, which Raw must escape.
+	want := update{ID: "x", Count: 13, Tags: []string{"a"}, Raw: []byte{'\r', 0x1b, 0}}
+	for _, c := range []evsrc.Codec{Base64, Raw} {
+		data, err := c.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range data {
+			if b == '\r' {
+				t.Errorf("%v encoded a carriage return", c.ContentType())
+			}
+		}
+
+		var got update
+		err = c.Unmarshal(data, &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v round trip got %#v, wanted %#v", c.ContentType(), got, want)
+		}
+	}
+}
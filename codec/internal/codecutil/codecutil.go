@@ -0,0 +1,490 @@
+// Package codecutil holds the parts of the binary codecs in evsrc/codec that
+// don't depend on the format: converting Go values to and from a tree of
+// generic values with reflection, and escaping binary data to send it raw.
+//
+// The generic values are nil, bool, int64 (for integers that fit),
+// uint64 (for larger ones), float32, float64, string, []byte, []interface{},
+// and Map.
+package codecutil
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Map is a generic map, kept as a list so that struct fields stay in order.
+type Map []Pair
+
+// A Pair is an entry of a Map.
+type Pair struct {
+	Key, Value interface{}
+}
+
+// MaxDepth limits how deeply values may nest, so that malicious input can't
+// exhaust the stack.
+const MaxDepth = 1000
+
+// ErrTooDeep is returned for values nested more than MaxDepth deep.
+var ErrTooDeep = errors.New("value nested too deeply")
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// FromGo converts v to a generic value. Struct fields are named by their tag
+// with the given key, such as `msgpack:"name,omitempty"`, as encoding/json
+// names them with json tags. Values implementing encoding.TextMarshaler are
+// converted to strings.
+func FromGo(v interface{}, tagKey string) (interface{}, error) {
+	return fromGo(reflect.ValueOf(v), tagKey, 0)
+}
+
+func fromGo(v reflect.Value, tagKey string, depth int) (interface{}, error) {
+	if depth > MaxDepth {
+		return nil, ErrTooDeep
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(text), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Uint(v.Uint()), nil
+	case reflect.Float32:
+		return float32(v.Float()), nil
+	case reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return fromGo(v.Elem(), tagKey, depth+1)
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return b, nil
+		}
+
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			var err error
+			list[i], err = fromGo(v.Index(i), tagKey, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		m := make(Map, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := fromGo(iter.Key(), tagKey, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			e, err := fromGo(iter.Value(), tagKey, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, Pair{k, e})
+		}
+
+		// Sort the keys so that the encoding is deterministic.
+		sort.Slice(m, func(i, j int) bool {
+			return fmt.Sprint(m[i].Key) < fmt.Sprint(m[j].Key)
+		})
+		return m, nil
+
+	case reflect.Struct:
+		var m Map
+		for _, f := range structFields(v.Type(), tagKey) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			e, err := fromGo(fv, tagKey, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, Pair{f.name, e})
+		}
+		if m == nil {
+			m = Map{}
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
+}
+
+// Uint returns u as an int64 if it fits, so that integers decode the same way
+// whatever their sign in the encoding, or as a uint64 otherwise.
+func Uint(u uint64) interface{} {
+	if u <= 1<<63-1 {
+		return int64(u)
+	}
+	return u
+}
+
+type field struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type, tagKey string) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(sf.Tag.Get(tagKey), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{index: i, name: name, omitEmpty: opts == "omitempty"})
+	}
+	return fields
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// ToGo stores the generic value g in the value pointed to by v, which must be
+// a non-nil pointer. Generic Maps are stored in interface{} values as
+// map[string]interface{} if all their keys are strings, and as
+// map[interface{}]interface{} otherwise. Map keys without a matching struct
+// field are ignored; keys are matched to fields as by FromGo, or failing that,
+// case-insensitively to field names.
+func ToGo(g interface{}, v interface{}, tagKey string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot unmarshal into non-pointer %T", v)
+	}
+	return toGo(g, rv.Elem(), tagKey)
+}
+
+func toGo(g interface{}, v reflect.Value, tagKey string) error {
+	if g == nil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return toGo(g, v.Elem(), tagKey)
+	}
+
+	if s, ok := g.(string); ok && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(natural(g)))
+		return nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cannot unmarshal %T into Go value of type %v", g, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := g.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := g.(int64)
+		if !ok || v.OverflowInt(i) {
+			return mismatch()
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := g.(type) {
+		case int64:
+			if n < 0 {
+				return mismatch()
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(u) {
+			return mismatch()
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		switch n := g.(type) {
+		case float32:
+			v.SetFloat(float64(n))
+		case float64:
+			v.SetFloat(n)
+		case int64:
+			v.SetFloat(float64(n))
+		case uint64:
+			v.SetFloat(float64(n))
+		default:
+			return mismatch()
+		}
+
+	case reflect.String:
+		switch s := g.(type) {
+		case string:
+			v.SetString(s)
+		case []byte:
+			v.SetString(string(s))
+		default:
+			return mismatch()
+		}
+
+	case reflect.Slice:
+		if b, ok := g.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		list, ok := g.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		s := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, e := range list {
+			err := toGo(e, s.Index(i), tagKey)
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+
+	case reflect.Array:
+		if b, ok := g.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			if len(b) > v.Len() {
+				return mismatch()
+			}
+			v.Set(reflect.Zero(v.Type()))
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		list, ok := g.([]interface{})
+		if !ok || len(list) > v.Len() {
+			return mismatch()
+		}
+		v.Set(reflect.Zero(v.Type()))
+		for i, e := range list {
+			err := toGo(e, v.Index(i), tagKey)
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		m, ok := g.(Map)
+		if !ok {
+			return mismatch()
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		}
+		for _, p := range m {
+			k := reflect.New(v.Type().Key()).Elem()
+			err := toGo(p.Key, k, tagKey)
+			if err != nil {
+				return err
+			}
+			e := reflect.New(v.Type().Elem()).Elem()
+			err = toGo(p.Value, e, tagKey)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(k, e)
+		}
+
+	case reflect.Struct:
+		m, ok := g.(Map)
+		if !ok {
+			return mismatch()
+		}
+		fields := structFields(v.Type(), tagKey)
+		for _, p := range m {
+			name, ok := p.Key.(string)
+			if !ok {
+				continue
+			}
+			f, ok := findField(fields, name)
+			if !ok {
+				continue
+			}
+			err := toGo(p.Value, v.Field(f.index), tagKey)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return mismatch()
+	}
+
+	return nil
+}
+
+func findField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// natural converts g to the types it is stored as in an interface{}.
+func natural(g interface{}) interface{} {
+	switch g := g.(type) {
+	case []interface{}:
+		list := make([]interface{}, len(g))
+		for i, e := range g {
+			list[i] = natural(e)
+		}
+		return list
+
+	case Map:
+		stringKeys := true
+		for _, p := range g {
+			if _, ok := p.Key.(string); !ok {
+				stringKeys = false
+				break
+			}
+		}
+
+		if stringKeys {
+			m := make(map[string]interface{}, len(g))
+			for _, p := range g {
+				m[p.Key.(string)] = natural(p.Value)
+			}
+			return m
+		}
+
+		m := make(map[interface{}]interface{}, len(g))
+		for _, p := range g {
+			k := natural(p.Key)
+			if !reflect.TypeOf(k).Comparable() {
+				k = fmt.Sprint(k)
+			}
+			m[k] = natural(p.Value)
+		}
+		return m
+	}
+	return g
+}
+
+// escapeByte starts the escape sequences used by Escape.
+const escapeByte = 0x1b
+
+// Escape returns b with its carriage returns replaced, so that it can be sent
+// as raw Event Data: 0x0d becomes 0x1b 'r', and 0x1b becomes 0x1b 0x1b. Line
+// feeds survive the event stream format unchanged, but carriage returns would
+// be turned into line feeds.
+func Escape(b []byte) []byte {
+	n := bytes.Count(b, []byte{'\r'}) + bytes.Count(b, []byte{escapeByte})
+	if n == 0 {
+		return b
+	}
+
+	escaped := make([]byte, 0, len(b)+n)
+	for _, c := range b {
+		switch c {
+		case '\r':
+			escaped = append(escaped, escapeByte, 'r')
+		case escapeByte:
+			escaped = append(escaped, escapeByte, escapeByte)
+		default:
+			escaped = append(escaped, c)
+		}
+	}
+	return escaped
+}
+
+// ErrBadEscape is returned by Unescape for data that was not produced by
+// Escape.
+var ErrBadEscape = errors.New("invalid escape sequence in raw binary data")
+
+// Unescape reverses Escape.
+func Unescape(b []byte) ([]byte, error) {
+	if bytes.IndexByte(b, escapeByte) < 0 {
+		return b, nil
+	}
+
+	raw := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c != escapeByte {
+			raw = append(raw, c)
+			continue
+		}
+
+		i++
+		if i == len(b) {
+			return nil, ErrBadEscape
+		}
+		switch b[i] {
+		case 'r':
+			raw = append(raw, '\r')
+		case escapeByte:
+			raw = append(raw, escapeByte)
+		default:
+			return nil, ErrBadEscape
+		}
+	}
+	return raw, nil
+}
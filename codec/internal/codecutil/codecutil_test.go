@@ -0,0 +1,102 @@
+package codecutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		raw, escaped string
+	}{
+		{"", ""},
+		{"plain\n", "plain\n"},
+		{"a\rb", "a\x1brb"},
+		{"\x1b\r\x1b", "\x1b\x1b\x1br\x1b\x1b"},
+	}
+	for _, test := range tests {
+		got := Escape([]byte(test.raw))
+		if string(got) != test.escaped {
+			t.Errorf("Escape(%q) = %q, wanted %q", test.raw, got, test.escaped)
+		}
+		if bytes.IndexByte(got, '\r') >= 0 {
+			t.Errorf("Escape(%q) left a carriage return", test.raw)
+		}
+
+		back, err := Unescape(got)
+		if err != nil || string(back) != test.raw {
+			t.Errorf("Unescape(%q) = %q, %v, wanted %q", got, back, err, test.raw)
+		}
+	}
+
+	for _, bad := range []string{"\x1b", "\x1bx"} {
+		if _, err := Unescape([]byte(bad)); err != ErrBadEscape {
+			t.Errorf("Unescape(%q) returned %v, wanted ErrBadEscape", bad, err)
+		}
+	}
+}
+
+type inner struct {
+	At time.Time `t:"at"`
+}
+
+type outer struct {
+	Name    string `t:"name"`
+	Count   uint8  `t:",omitempty"`
+	Inner   *inner
+	Values  map[string][]int
+	Fixed   [2]byte
+	private int
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := outer{
+		Name:   "x",
+		Inner:  &inner{At: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		Values: map[string][]int{"a": {1, -2}},
+		Fixed:  [2]byte{7, 8},
+	}
+
+	g, err := FromGo(want, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{}
+	for _, p := range g.(Map) {
+		keys = append(keys, p.Key.(string))
+	}
+	if !reflect.DeepEqual(keys, []string{"name", "Inner", "Values", "Fixed"}) {
+		t.Errorf("Got struct keys %v", keys)
+	}
+
+	var got outer
+	err = ToGo(g, &got, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %#v, wanted %#v", got, want)
+	}
+
+	// Keys match field names case-insensitively, as with encoding/json.
+	err = ToGo(Map{{"NAME", "y"}, {"count", int64(300)}}, &got, "t")
+	if err == nil {
+		t.Errorf("ToGo stored 300 in a uint8")
+	}
+	if got.Name != "y" {
+		t.Errorf("Got Name %q, wanted it matched case-insensitively", got.Name)
+	}
+}
+
+func TestTooDeep(t *testing.T) {
+	var v interface{}
+	for i := 0; i <= MaxDepth+1; i++ {
+		v = []interface{}{v}
+	}
+	if _, err := FromGo(v, ""); err != ErrTooDeep {
+		t.Errorf("FromGo returned %v, wanted ErrTooDeep", err)
+	}
+}
@@ -0,0 +1,353 @@
+// Package msgpack provides evsrc Codecs for MessagePack, a binary encoding
+// that is more compact than JSON, for streams where bandwidth matters.
+//
+// Event Data is text, so the encoding can be sent in two ways: Base64, which
+// any client can read, and Raw, which deviates from the event stream format
+// by sending the bytes nearly as they are, and only works between clients and
+// servers that both use this package. Importing the package registers both
+// with evsrc.RegisterCodec.
+//
+// Values are converted as encoding/json converts them, with struct fields
+// named by "msgpack" tags instead of "json" ones.
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/encryptio/go-evsrc"
+	"github.com/encryptio/go-evsrc/codec/internal/codecutil"
+)
+
+// ContentType is the MIME type of MessagePack data.
+const ContentType = "application/msgpack"
+
+var (
+	// Base64 sends base64 encoded MessagePack, with the content type
+	// "application/msgpack;base64".
+	Base64 = evsrc.Base64Codec(binaryCodec{})
+
+	// Raw sends MessagePack with only carriage returns escaped (0x0d as
+	// 0x1b 'r', and 0x1b as 0x1b 0x1b), with the content type
+	// "application/msgpack;raw". The result is usually not valid UTF-8, so
+	// browsers and strict clients can't read it, but it is a quarter smaller
+	// than Base64.
+	Raw evsrc.Codec = rawCodec{}
+)
+
+func init() {
+	evsrc.RegisterCodec(Base64)
+	evsrc.RegisterCodec(Raw)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) ContentType() string                        { return ContentType }
+func (binaryCodec) Marshal(v interface{}) ([]byte, error)      { return Marshal(v) }
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error { return Unmarshal(data, v) }
+
+type rawCodec struct{}
+
+func (rawCodec) ContentType() string { return ContentType + ";raw" }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return codecutil.Escape(data), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	data, err := codecutil.Unescape(data)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, v)
+}
+
+// Marshal returns the MessagePack encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	g, err := codecutil.FromGo(v, "msgpack")
+	if err != nil {
+		return nil, err
+	}
+	return encode(nil, g), nil
+}
+
+// Unmarshal decodes the MessagePack value in data into the value pointed to by
+// v. Extension types are not supported.
+func Unmarshal(data []byte, v interface{}) error {
+	d := decoder{data: data}
+	g, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if len(d.data) > 0 {
+		return errTrailingData
+	}
+	return codecutil.ToGo(g, v, "msgpack")
+}
+
+var (
+	errTrailingData = errors.New("msgpack: data after the end of the value")
+	errTruncated    = errors.New("msgpack: data ends in the middle of a value")
+)
+
+func encode(b []byte, g interface{}) []byte {
+	switch g := g.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if g {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+
+	case int64:
+		switch {
+		case g >= 0:
+			return encodeUint(b, uint64(g))
+		case g >= -32:
+			return append(b, byte(g))
+		case g >= math.MinInt8:
+			return append(b, 0xd0, byte(g))
+		case g >= math.MinInt16:
+			return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(g))
+		case g >= math.MinInt32:
+			return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(g))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(g))
+	case uint64:
+		return encodeUint(b, g)
+
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(g))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(g))
+
+	case string:
+		b = encodeLen(b, len(g), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		return append(b, g...)
+	case []byte:
+		b = encodeLen(b, len(g), 0, 0, 0xc4, 0xc5, 0xc6)
+		return append(b, g...)
+
+	case []interface{}:
+		b = encodeLen(b, len(g), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range g {
+			b = encode(b, e)
+		}
+		return b
+	case codecutil.Map:
+		b = encodeLen(b, len(g), 0x80, 16, 0, 0xde, 0xdf)
+		for _, p := range g {
+			b = encode(b, p.Key)
+			b = encode(b, p.Value)
+		}
+		return b
+	}
+
+	panic(fmt.Sprintf("msgpack: unexpected generic value %T", g))
+}
+
+func encodeUint(b []byte, u uint64) []byte {
+	switch {
+	case u < 128:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+}
+
+// encodeLen appends the header of a string, binary, array, or map of length
+// n: the fix format starting at fix if n is below fixMax, or else the first of
+// the 8, 16, and 32-bit formats that fits. Formats that don't exist are zero.
+func encodeLen(b []byte, n int, fix byte, fixMax int, f8, f16, f32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && f8 != 0:
+		return append(b, f8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, f16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, f32), uint32(n))
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data) {
+		return nil, errTruncated
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+func (d *decoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > codecutil.MaxDepth {
+		return nil, codecutil.ErrTooDeep
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return d.mapValue(int(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return codecutil.Uint(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign extend from the encoded size.
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(uint32(u)), nil
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(u), nil
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), raw...), nil
+
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(int(n), depth)
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported format byte %#x", c)
+}
+
+func (d *decoder) str(n int) (interface{}, error) {
+	raw, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (d *decoder) array(n int, depth int) (interface{}, error) {
+	// Every element takes at least a byte, so a longer array is truncated,
+	// and shouldn't be allocated.
+	if n < 0 || n > len(d.data) {
+		return nil, errTruncated
+	}
+
+	list := make([]interface{}, n)
+	for i := range list {
+		var err error
+		list[i], err = d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (d *decoder) mapValue(n int, depth int) (interface{}, error) {
+	if n < 0 || n > len(d.data)/2 {
+		return nil, errTruncated
+	}
+
+	m := make(codecutil.Map, n)
+	for i := range m {
+		var err error
+		m[i].Key, err = d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[i].Value, err = d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
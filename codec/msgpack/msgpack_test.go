@@ -0,0 +1,157 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{0, "00"},
+		{127, "7f"},
+		{128, "cc80"},
+		{65536, "ce00010000"},
+		{uint64(1) << 63, "cf8000000000000000"},
+		{-1, "ff"},
+		{-32, "e0"},
+		{-33, "d0df"},
+		{-129, "d1ff7f"},
+		{-1 << 40, "d3ffffff0000000000"},
+		{float32(1.5), "ca3fc00000"},
+		{1.5, "cb3ff8000000000000"},
+		{"", "a0"},
+		{"abc", "a3616263"},
+		{strings.Repeat("x", 32), "d920" + strings.Repeat("78", 32)},
+		{[]byte{1, 2}, "c4020102"},
+		{[]int{1, 2}, "920102"},
+		{make([]int, 16), "dc0010" + strings.Repeat("00", 16)},
+		{map[string]int{"b": 2, "a": 1}, "82a16101a16202"},
+	}
+	for _, test := range tests {
+		data, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v) returned %v", test.v, err)
+			continue
+		}
+		if got := hex.EncodeToString(data); got != test.want {
+			t.Errorf("Marshal(%#v) = %v, wanted %v", test.v, got, test.want)
+		}
+
+		var back interface{}
+		err = Unmarshal(data, &back)
+		if err != nil {
+			t.Errorf("Unmarshal(%v) returned %v", test.want, err)
+		}
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	data, _ := hex.DecodeString("93c2d0df81a178cb3ff8000000000000")
+	var got interface{}
+	err := Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{false, int64(-33), map[string]interface{}{"x": 1.5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %#v, wanted %#v", got, want)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	for _, s := range []string{"", "cc", "a3ab", "93", "c1", "d4", "0000", "dfffffffff", "8101"} {
+		data, _ := hex.DecodeString(s)
+		var v interface{}
+		if err := Unmarshal(data, &v); err == nil {
+			t.Errorf("Unmarshal(%v) succeeded with %#v", s, v)
+		}
+	}
+}
+
+type update struct {
+	ID    string   `msgpack:"id"`
+	Count int      `msgpack:"n,omitempty"`
+	Tags  []string `msgpack:"tags"`
+	Raw   []byte
+	Skip  int `msgpack:"-"`
+}
+
+func TestCodecs(t *testing.T) {
+	if c, ok := evsrc.LookupCodec("application/msgpack;base64"); !ok || c != Base64 {
+		t.Errorf("Base64 is not registered")
+	}
+	if c, ok := evsrc.LookupCodec("application/msgpack;raw"); !ok || c != Raw {
+		t.Errorf("Raw is not registered")
+	}
+
+	// 13 is a carriage return, which Raw must escape.
+	want := update{ID: "x", Count: 13, Tags: []string{"a"}, Raw: []byte{'\r', 0x1b, 0}}
+	for _, c := range []evsrc.Codec{Base64, Raw} {
+		data, err := c.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range data {
+			if b == '\r' {
+				t.Errorf("%v encoded a carriage return", c.ContentType())
+			}
+		}
+
+		var got update
+		err = c.Unmarshal(data, &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v round trip got %#v, wanted %#v", c.ContentType(), got, want)
+		}
+	}
+}
+
+func TestRawOverStream(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := evsrc.NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte("\n \r\n\x00\xff\x1b\r:\n")
+	err = conn.SendEncoded(Raw, "blob", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := evsrc.NewClientConn(bufio.NewReader(w.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, ok := ev.Codec()
+	if !ok || c != Raw {
+		t.Fatalf("Got content type %q", ev.ContentType)
+	}
+	var got []byte
+	err = ev.Decode(c, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+}
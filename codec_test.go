@@ -0,0 +1,136 @@
+package evsrc
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string { return "text/x-upper" }
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(v.(string) + "!"), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = string(data[:len(data)-1])
+	return nil
+}
+
+func TestCodecRegistry(t *testing.T) {
+	c, ok := LookupCodec("application/json")
+	if !ok || c != JSONCodec {
+		t.Errorf("JSONCodec is not registered by default")
+	}
+
+	_, ok = LookupCodec("text/x-upper")
+	if ok {
+		t.Fatalf("Found a codec before registering it")
+	}
+
+	RegisterCodec(upperCodec{})
+	t.Cleanup(func() { unregisterCodec("text/x-upper") })
+	c, ok = LookupCodec("text/x-upper")
+	if !ok || c != (upperCodec{}) {
+		t.Errorf("Registered codec was not found")
+	}
+}
+
+func TestServerConnSendEncoded(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SendEncoded(JSONCodec, "update", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: update\ncontent-type: application/json\ndata: {\"n\":1}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+}
+
+func TestEventDecode(t *testing.T) {
+	var v struct{ N int }
+	err := Event{Data: []byte(`{"N": 5}`)}.Decode(JSONCodec, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.N != 5 {
+		t.Errorf("Decoded %#v, wanted N = 5", v)
+	}
+}
+
+func TestJSONHelpers(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SendJSON("update", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: update\ncontent-type: application/json\ndata: {\"n\":1}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+
+	var v struct{ N int }
+	err = Event{Data: []byte(`{"n": 5}`)}.UnmarshalData(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.N != 5 {
+		t.Errorf("Unmarshaled %#v, wanted N = 5", v)
+	}
+
+	err = conn.SendJSON("bad", make(chan int))
+	if err == nil {
+		t.Errorf("SendJSON of a channel succeeded")
+	}
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) ContentType() string { return "application/x-binary" }
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte{0, '\r', '\n', v.(byte)}, nil
+}
+
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*byte) = data[3]
+	return nil
+}
+
+func TestBase64Codec(t *testing.T) {
+	c := Base64Codec(binaryCodec{})
+	if c.ContentType() != "application/x-binary;base64" {
+		t.Errorf("Got content type %#v", c.ContentType())
+	}
+
+	data, err := c.Marshal(byte(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "AA0KBw==" {
+		t.Errorf("Got data %#v, wanted %#v", string(data), "AA0KBw==")
+	}
+
+	var got byte
+	err = c.Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 7 {
+		t.Errorf("Got %v, wanted 7", got)
+	}
+}
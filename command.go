@@ -0,0 +1,108 @@
+package evsrc
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strconv"
+)
+
+// Event names used by StreamCommand.
+const (
+	// StdoutEventName is the name of Events holding a line of a command's
+	// standard output.
+	StdoutEventName = "stdout"
+
+	// StderrEventName is the name of Events holding a line of a command's
+	// standard error.
+	StderrEventName = "stderr"
+
+	// ExitEventName is the name of the Event holding a command's exit code,
+	// in decimal.
+	ExitEventName = "exit"
+)
+
+// StreamCommand runs cmd and streams its output as the response to r, using
+// StreamFunc. cmd must not have been started, and its Stdout and Stderr must
+// be unset.
+//
+// Each line the command writes is sent as soon as it is read, as an Event named
+// StdoutEventName or StderrEventName. Lines from the two streams are sent in
+// the order they are read, which is not necessarily the order they were
+// written. Progress output that redraws a line with carriage returns arrives
+// with each one as a line feed in the Event's Data, as Send writes them.
+//
+// Once the command exits, an Event named ExitEventName holding its exit code
+// is sent, followed by StreamFunc's final Event. A command that runs and fails
+// is not an error; it is reported only by its exit code.
+//
+// If r's context is done or sending fails before the command exits, the
+// command is killed.
+func StreamCommand(w http.ResponseWriter, r *http.Request, cmd *exec.Cmd) error {
+	return StreamFunc(w, r, func(send func(Event) error) error {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			return err
+		}
+
+		err = cmd.Start()
+		if err != nil {
+			return err
+		}
+
+		outTail := TailReader(stdout, commandLineEvent(StdoutEventName))
+		defer outTail.Stop()
+		errTail := TailReader(stderr, commandLineEvent(StderrEventName))
+		defer errTail.Stop()
+
+		ctx := r.Context()
+		outC, errC := outTail.Events(), errTail.Events()
+		for outC != nil || errC != nil {
+			var ev Event
+			var ok bool
+			select {
+			case ev, ok = <-outC:
+				if !ok {
+					outC = nil
+					continue
+				}
+			case ev, ok = <-errC:
+				if !ok {
+					errC = nil
+					continue
+				}
+			case <-ctx.Done():
+				err = context.Cause(ctx)
+			}
+
+			if err == nil {
+				err = send(ev)
+			}
+			if err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return err
+			}
+		}
+
+		err = cmd.Wait()
+		if _, ok := err.(*exec.ExitError); err != nil && !ok {
+			return err
+		}
+
+		return send(Event{
+			Event: ExitEventName,
+			Data:  []byte(strconv.Itoa(cmd.ProcessState.ExitCode())),
+		})
+	})
+}
+
+func commandLineEvent(name string) func([]byte) Event {
+	return func(line []byte) Event {
+		return Event{Event: name, Data: line}
+	}
+}
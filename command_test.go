@@ -0,0 +1,111 @@
+package evsrc
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh available")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	cmd := exec.Command("sh", "-c", "echo one; echo oops >&2; sleep 0.05; echo two; exit 3")
+
+	err := StreamCommand(rec, req, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _ := NewClientConn(bufio.NewReader(rec.Body))
+	var stdout, stderr []string
+	var names []string
+	for {
+		ev, err := conn.ReceiveOwned()
+		if err != nil {
+			break
+		}
+		switch ev.Event {
+		case StdoutEventName:
+			stdout = append(stdout, string(ev.Data))
+		case StderrEventName:
+			stderr = append(stderr, string(ev.Data))
+		default:
+			names = append(names, ev.Event+"="+string(ev.Data))
+		}
+	}
+
+	if got := strings.Join(stdout, ","); got != "one,two" {
+		t.Errorf("got stdout %q, wanted %q", got, "one,two")
+	}
+	if got := strings.Join(stderr, ","); got != "oops" {
+		t.Errorf("got stderr %q, wanted %q", got, "oops")
+	}
+	if got := strings.Join(names, ","); got != "exit=3,done=" {
+		t.Errorf("got final events %q, wanted %q", got, "exit=3,done=")
+	}
+}
+
+func TestStreamCommandProgress(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh available")
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	cmd := exec.Command("sh", "-c", `printf '10%%\r20%%\r30%%\r\ndone\n'`)
+
+	err := StreamCommand(rec, req, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _ := NewClientConn(bufio.NewReader(rec.Body))
+	var stdout []string
+	for {
+		ev, err := conn.ReceiveOwned()
+		if err != nil {
+			break
+		}
+		if ev.Event == StdoutEventName {
+			stdout = append(stdout, string(ev.Data))
+		}
+	}
+
+	want := []string{"10%\n20%\n30%", "done"}
+	if strings.Join(stdout, ",") != strings.Join(want, ",") {
+		t.Errorf("got stdout %q, wanted %q", stdout, want)
+	}
+}
+
+func TestStreamCommandCancel(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	cmd := exec.Command("sh", "-c", "echo started; exec sleep 10")
+
+	start := time.Now()
+	err := StreamCommand(rec, req, cmd)
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error %v, wanted %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("StreamCommand took %v to notice cancellation", elapsed)
+	}
+	if cmd.ProcessState == nil || cmd.ProcessState.Success() {
+		t.Errorf("command was not killed: %v", cmd.ProcessState)
+	}
+}
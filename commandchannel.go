@@ -0,0 +1,135 @@
+package evsrc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ConnectionEventName is the name of the first Event sent by
+// CommandChannel.Stream, whose Data is the token identifying the connection.
+const ConnectionEventName = "connection"
+
+// maxCommandSize bounds the body of a command POSTed to a CommandChannel.
+const maxCommandSize = 1024 * 1024
+
+// commandQueueSize is how many commands may wait for a connection's handler
+// before more are refused.
+const commandQueueSize = 16
+
+// A CommandChannel pairs event streams with a POST endpoint that sends
+// commands up to them, giving request/response exchanges over plain HTTP.
+//
+// A client opens the stream served by Stream, and reads the token from its
+// first Event, named ConnectionEventName. It then POSTs commands to the
+// handler served by ServeHTTP, with the token in the "connection" query
+// parameter and the command as the request body. Each command is given to the
+// handler of the stream it names, which answers by sending Events down that
+// stream:
+//
+//	commands := &evsrc.CommandChannel{}
+//	http.Handle("/commands", commands)
+//	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+//		commands.Stream(w, r, func(cmd []byte, send func(evsrc.Event) error) error {
+//			return send(evsrc.Event{Event: "echo", Data: cmd})
+//		})
+//	})
+//
+// The zero CommandChannel is ready to use. CommandChannels are safe for
+// concurrent use.
+type CommandChannel struct {
+	mu    sync.Mutex
+	conns map[string]chan []byte
+}
+
+// Stream serves an event stream for r that receives commands, using
+// StreamFunc. Commands are passed to handle one at a time, in the order they
+// were POSTed. Stream runs until r's context is done, or until handle returns
+// an error, which ends the stream.
+func (c *CommandChannel) Stream(w http.ResponseWriter, r *http.Request, handle func(cmd []byte, send func(Event) error) error) error {
+	return StreamFunc(w, r, func(send func(Event) error) error {
+		token, commands, err := c.register()
+		if err != nil {
+			return err
+		}
+		defer c.unregister(token)
+
+		err = send(Event{Event: ConnectionEventName, Data: []byte(token)})
+		if err != nil {
+			return err
+		}
+
+		for {
+			select {
+			case cmd := <-commands:
+				err := handle(cmd, send)
+				if err != nil {
+					return err
+				}
+			case <-r.Context().Done():
+				return context.Cause(r.Context())
+			}
+		}
+	})
+}
+
+func (c *CommandChannel) register() (string, chan []byte, error) {
+	raw := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, raw)
+	if err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	commands := make(chan []byte, commandQueueSize)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		c.conns = make(map[string]chan []byte)
+	}
+	c.conns[token] = commands
+
+	return token, commands, nil
+}
+
+func (c *CommandChannel) unregister(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, token)
+}
+
+// ServeHTTP accepts a command POSTed for the stream named by the "connection"
+// query parameter. It responds 202 Accepted once the command is queued for the
+// stream's handler, 404 Not Found if there is no such stream, or 503 Service
+// Unavailable if the stream has too many commands waiting.
+func (c *CommandChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "commands must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mu.Lock()
+	commands, ok := c.conns[r.URL.Query().Get("connection")]
+	c.mu.Unlock()
+	if !ok {
+		http.Error(w, "no such connection", http.StatusNotFound)
+		return
+	}
+
+	cmd, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCommandSize))
+	if err != nil {
+		http.Error(w, "can't read command: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case commands <- cmd:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "too many commands waiting", http.StatusServiceUnavailable)
+	}
+}
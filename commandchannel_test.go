@@ -0,0 +1,77 @@
+package evsrc
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCommandChannel(t *testing.T) {
+	commands := &CommandChannel{}
+
+	mux := http.NewServeMux()
+	mux.Handle("/commands", commands)
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		commands.Stream(w, r, func(cmd []byte, send func(Event) error) error {
+			return send(Event{Event: "echo", Data: cmd})
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	client, _ := NewClientConn(bufio.NewReader(resp.Body))
+	ev, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Event != ConnectionEventName || len(ev.Data) == 0 {
+		t.Fatalf("Got first event %#v, wanted a connection token", ev)
+	}
+	token := string(ev.Data)
+
+	post := func(token, body string) int {
+		resp, err := http.Post(server.URL+"/commands?connection="+token, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, cmd := range []string{"first", "second"} {
+		if code := post(token, cmd); code != http.StatusAccepted {
+			t.Fatalf("POSTing %q got status %v, wanted %v", cmd, code, http.StatusAccepted)
+		}
+	}
+	for _, want := range []string{"first", "second"} {
+		ev, err := client.ReceiveOwned()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ev.Eq(Event{Event: "echo", Data: []byte(want)}) {
+			t.Errorf("Got event %#v, wanted an echo of %q", ev, want)
+		}
+	}
+
+	if code := post("bogus", "x"); code != http.StatusNotFound {
+		t.Errorf("POSTing to an unknown connection got status %v, wanted %v", code, http.StatusNotFound)
+	}
+
+	resp, err = http.Get(server.URL + "/commands?connection=" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET got status %v, wanted %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
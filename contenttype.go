@@ -0,0 +1,37 @@
+package evsrc
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// contentTypeField is the extension field carrying an Event's ContentType.
+const contentTypeField = "content-type"
+
+// Content types set by the ServerConn Send helpers.
+const (
+	// TextContentType is the ContentType of Events sent by SendText.
+	TextContentType = "text/plain"
+
+	// HTMLContentType is the ContentType of Events sent by SendHTML.
+	HTMLContentType = "text/html"
+
+	// Base64ContentType is the ContentType of Events sent by SendBase64,
+	// whose Data is arbitrary bytes in standard base64.
+	Base64ContentType = "application/octet-stream;base64"
+)
+
+// Bytes returns e's Data, decoded from base64 if its ContentType is
+// Base64ContentType.
+func (e Event) Bytes() ([]byte, error) {
+	if e.ContentType != Base64ContentType {
+		return e.Data, nil
+	}
+
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(e.Data)))
+	n, err := base64.StdEncoding.Decode(data, e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 event data: %v", err)
+	}
+	return data[:n], nil
+}
@@ -0,0 +1,103 @@
+package evsrc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SendText("t", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.SendHTML("h", "<p>hi</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.SendBase64("b", []byte{0, '\r', '\n', 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.SendJSON("j", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Send(Event{Event: "plain", Data: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientConn(bufio.NewReader(bytes.NewReader(w.Body.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{Event: "t", Data: []byte("hello"), ContentType: TextContentType},
+		{Event: "h", Data: []byte("<p>hi</p>"), ContentType: HTMLContentType},
+		{Event: "b", Data: []byte("AA0K/w=="), ContentType: Base64ContentType},
+		{Event: "j", Data: []byte("1"), ContentType: "application/json"},
+		{Event: "plain", Data: []byte("x")},
+	}
+	for _, wantEvent := range want {
+		got, err := client.ReceiveOwned()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Eq(wantEvent) {
+			t.Errorf("Got %#v, wanted %#v", got, wantEvent)
+		}
+	}
+	if _, err := client.ReceiveOwned(); err != io.EOF {
+		t.Errorf("Got error %v at the end of the stream, wanted io.EOF", err)
+	}
+	if warnings := client.Stats().ParseWarnings; warnings != 0 {
+		t.Errorf("Got %v parse warnings", warnings)
+	}
+
+	data, err := want[2].Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, '\r', '\n', 255}) {
+		t.Errorf("Bytes returned %#v", data)
+	}
+	data, err = want[0].Bytes()
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Bytes of a text Event returned %#v, %v", data, err)
+	}
+	_, err = Event{Data: []byte("!"), ContentType: Base64ContentType}.Bytes()
+	if err == nil {
+		t.Errorf("Bytes of invalid base64 succeeded")
+	}
+
+	w = httptest.NewRecorder()
+	conn, err = NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.OmitContentType = true
+	err = conn.SendJSON("j", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Body.String(); got != "event: j\ndata: 1\n\n" {
+		t.Errorf("Got %#v with OmitContentType", got)
+	}
+
+	if c, ok := want[3].Codec(); !ok || c != JSONCodec {
+		t.Errorf("Codec of a JSON Event returned %v, %v", c, ok)
+	}
+	if _, ok := want[4].Codec(); ok {
+		t.Errorf("Codec of an untagged Event succeeded")
+	}
+}
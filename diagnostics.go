@@ -0,0 +1,131 @@
+package evsrc
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"math"
+	"net/http"
+	"runtime/metrics"
+	"strings"
+	"time"
+)
+
+// DiagnosticsEventName is the name of the Events sent by Diagnostics.
+const DiagnosticsEventName = "diagnostics"
+
+// Diagnostics is an http.Handler that streams a snapshot of the process's
+// expvar variables and runtime/metrics samples every Interval, so that a
+// simple live dashboard can watch a process without other infrastructure.
+//
+// Each snapshot is sent as an Event named DiagnosticsEventName whose Data is a
+// JSON object mapping each name to its value, for example
+//
+//	{"/sched/goroutines:goroutines": 12, "requests": 3041}
+//
+// Names starting with "/" are runtime/metrics names. Float64Histogram metrics
+// are sent as objects with "buckets" and "counts" arrays, and metrics not
+// supported by the running Go version are omitted. Other names are expvar
+// variables, sent as the JSON given by their String method; unpublished
+// variables are omitted.
+//
+// The stream runs until the client goes away. Diagnostics exposes internal
+// details of the process, so it should not be served to untrusted clients.
+type Diagnostics struct {
+	// Names lists the expvar variables and runtime/metrics to send. If empty,
+	// every published expvar variable is sent.
+	Names []string
+
+	// Interval is the time between snapshots. If zero, a second is used.
+	Interval time.Duration
+
+	// Clock is used to wait between snapshots. If nil, the system clock is
+	// used.
+	Clock Clock
+}
+
+// ServeHTTP streams snapshots as the response to r, using StreamFunc.
+func (d *Diagnostics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	clock := clockOrSystem(d.Clock)
+
+	StreamFunc(w, r, func(send func(Event) error) error {
+		for {
+			data, err := d.snapshot()
+			if err != nil {
+				return err
+			}
+
+			err = send(Event{Event: DiagnosticsEventName, Data: data})
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-clock.After(interval):
+			case <-r.Context().Done():
+				return context.Cause(r.Context())
+			}
+		}
+	})
+}
+
+func (d *Diagnostics) snapshot() ([]byte, error) {
+	values := make(map[string]interface{})
+
+	var samples []metrics.Sample
+	if len(d.Names) == 0 {
+		expvar.Do(func(kv expvar.KeyValue) {
+			values[kv.Key] = json.RawMessage(kv.Value.String())
+		})
+	}
+	for _, name := range d.Names {
+		if strings.HasPrefix(name, "/") {
+			samples = append(samples, metrics.Sample{Name: name})
+		} else if v := expvar.Get(name); v != nil {
+			values[name] = json.RawMessage(v.String())
+		}
+	}
+
+	metrics.Read(samples)
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			values[s.Name] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			values[s.Name] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			values[s.Name] = histogramJSON{jsonFloats(h.Buckets), h.Counts}
+		}
+	}
+
+	return json.Marshal(values)
+}
+
+type histogramJSON struct {
+	Buckets []jsonFloat `json:"buckets"`
+	Counts  []uint64    `json:"counts"`
+}
+
+// jsonFloat is a float64 that encodes infinities, which JSON lacks, as null.
+// Histogram buckets usually start or end at an infinity.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func jsonFloats(fs []float64) []jsonFloat {
+	out := make([]jsonFloat, len(fs))
+	for i, f := range fs {
+		out[i] = jsonFloat(f)
+	}
+	return out
+}
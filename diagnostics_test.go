@@ -0,0 +1,91 @@
+package evsrc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var diagnosticsTestVar = expvar.NewInt("evsrc_diagnostics_test")
+
+type countingClock struct {
+	afters int
+	cancel func()
+}
+
+func (c *countingClock) Now() time.Time { return time.Time{} }
+
+func (c *countingClock) After(d time.Duration) <-chan time.Time {
+	c.afters++
+	if c.afters == 3 {
+		c.cancel()
+		return nil
+	}
+
+	diagnosticsTestVar.Add(1)
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+func TestDiagnostics(t *testing.T) {
+	diagnosticsTestVar.Set(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &Diagnostics{
+		Names: []string{
+			"evsrc_diagnostics_test",
+			"evsrc_no_such_var",
+			"/sched/goroutines:goroutines",
+			"/gc/heap/allocs-by-size:bytes",
+			"/no/such/metric:things",
+		},
+		Clock: &countingClock{cancel: cancel},
+	}
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	conn, _ := NewClientConn(bufio.NewReader(rec.Body))
+	var counts []int64
+	for {
+		ev, err := conn.ReceiveOwned()
+		if err != nil {
+			break
+		}
+		if ev.Event != DiagnosticsEventName {
+			t.Errorf("got unexpected Event %v", ev)
+			continue
+		}
+
+		var snap struct {
+			Test       *int64           `json:"evsrc_diagnostics_test"`
+			Goroutines *uint64          `json:"/sched/goroutines:goroutines"`
+			Allocs     *json.RawMessage `json:"/gc/heap/allocs-by-size:bytes"`
+		}
+		err = json.Unmarshal(ev.Data, &snap)
+		if err != nil {
+			t.Fatalf("couldn't parse snapshot %s: %v", ev.Data, err)
+		}
+		if snap.Test == nil || snap.Goroutines == nil || snap.Allocs == nil {
+			t.Fatalf("snapshot %s is missing values", ev.Data)
+		}
+		counts = append(counts, *snap.Test)
+
+		var all map[string]json.RawMessage
+		json.Unmarshal(ev.Data, &all)
+		if len(all) != 3 {
+			t.Errorf("got %v values in snapshot %s, wanted 3", len(all), ev.Data)
+		}
+	}
+
+	if len(counts) != 3 || counts[0] != 0 || counts[2] != 2 {
+		t.Errorf("got counter values %v in snapshots, wanted [0 1 2]", counts)
+	}
+}
@@ -0,0 +1,140 @@
+package evsrc
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// A DivergenceKind classifies a Divergence.
+type DivergenceKind int
+
+// The kinds of Divergence reported by Diff.
+const (
+	// Missing Events are in the first stream but not the second.
+	Missing DivergenceKind = iota
+
+	// Extra Events are in the second stream but not the first.
+	Extra
+
+	// Reordered Events are in both streams, but their positions relative to
+	// the other Events in both streams differ by more than the window.
+	Reordered
+
+	// Different Events have the same ID in both streams, but differ in some
+	// other field.
+	Different
+)
+
+func (k DivergenceKind) String() string {
+	switch k {
+	case Missing:
+		return "missing"
+	case Extra:
+		return "extra"
+	case Reordered:
+		return "reordered"
+	case Different:
+		return "different"
+	}
+	return "DivergenceKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Divergence is a difference between two streams found by Diff.
+type Divergence struct {
+	Kind DivergenceKind
+
+	// Key is the ID of the Events involved, or "#n" for the nth Event
+	// without an ID.
+	Key string
+
+	// A and B are the Events from the first and second streams. Only the one
+	// that exists is set for Missing and Extra Divergences.
+	A, B Event
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%v event %s", d.Kind, d.Key)
+}
+
+// Diff compares two recorded streams, such as the output of an old and a new
+// producer of the same events, and returns how b diverges from a.
+//
+// Events are matched by ID. Events without an ID are matched by their position
+// among the Events without an ID in each stream. Matched Events whose relative
+// positions differ by at most window are not considered Reordered.
+//
+// Divergences are returned in the order of a, followed by Extra Divergences in
+// the order of b.
+func Diff(a, b []Event, window int) []Divergence {
+	keysA := diffKeys(a)
+	keysB := diffKeys(b)
+
+	indexB := make(map[string]int, len(b))
+	for i, key := range keysB {
+		indexB[key] = i
+	}
+	indexA := make(map[string]int, len(a))
+	for i, key := range keysA {
+		indexA[key] = i
+	}
+
+	// Rank Events by their position among the Events present in both streams,
+	// so that a missing Event doesn't make everything after it "reordered".
+	rankB := make(map[string]int)
+	for _, key := range keysB {
+		if _, ok := indexA[key]; ok {
+			rankB[key] = len(rankB)
+		}
+	}
+
+	var divergences []Divergence
+	rankA := 0
+	for i, key := range keysA {
+		j, ok := indexB[key]
+		if !ok {
+			divergences = append(divergences, Divergence{Kind: Missing, Key: key, A: a[i]})
+			continue
+		}
+
+		if !eventsEqual(a[i], b[j]) {
+			divergences = append(divergences, Divergence{Kind: Different, Key: key, A: a[i], B: b[j]})
+		}
+
+		offset := rankA - rankB[key]
+		if offset > window || -offset > window {
+			divergences = append(divergences, Divergence{Kind: Reordered, Key: key, A: a[i], B: b[j]})
+		}
+		rankA++
+	}
+
+	for j, key := range keysB {
+		if _, ok := indexA[key]; !ok {
+			divergences = append(divergences, Divergence{Kind: Extra, Key: key, B: b[j]})
+		}
+	}
+
+	return divergences
+}
+
+func diffKeys(events []Event) []string {
+	keys := make([]string, len(events))
+	anonymous := 0
+	for i, e := range events {
+		if e.ID != "" {
+			keys[i] = e.ID
+			continue
+		}
+		keys[i] = "#" + strconv.Itoa(anonymous)
+		anonymous++
+	}
+	return keys
+}
+
+func eventsEqual(a, b Event) bool {
+	return a.Event == b.Event &&
+		bytes.Equal(a.Data, b.Data) &&
+		a.ID == b.ID &&
+		a.Retry == b.Retry &&
+		a.ContentType == b.ContentType
+}
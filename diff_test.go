@@ -0,0 +1,71 @@
+package evsrc
+
+import (
+	"testing"
+)
+
+func diffEvents(ids ...string) []Event {
+	var events []Event
+	for _, id := range ids {
+		events = append(events, Event{ID: id, Data: []byte("data " + id)})
+	}
+	return events
+}
+
+func TestDiffContentType(t *testing.T) {
+	a := diffEvents("1")
+	b := diffEvents("1")
+	b[0].ContentType = "application/json"
+
+	got := Diff(a, b, 0)
+	if len(got) != 1 || got[0].String() != "different event 1" {
+		t.Errorf("Got divergences %v, wanted the content type difference", got)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	events := diffEvents("1", "2", "3")
+	got := Diff(events, events, 0)
+	if len(got) != 0 {
+		t.Errorf("Got divergences %v for identical streams", got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := diffEvents("1", "2", "3", "4", "5", "6")
+	b := diffEvents("1", "3", "2", "4", "6", "7")
+	b[3].Data = []byte("changed")
+
+	got := Diff(a, b, 0)
+	want := []string{
+		"reordered event 2",
+		"reordered event 3",
+		"different event 4",
+		"missing event 5",
+		"extra event 7",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got divergences %v, wanted %v", got, want)
+	}
+	for i := range got {
+		if got[i].String() != want[i] {
+			t.Errorf("Got divergences %v, wanted %v", got, want)
+			break
+		}
+	}
+
+	got = Diff(a, b, 1)
+	if len(got) != 3 {
+		t.Errorf("Got divergences %v with window 1, wanted only the different, missing, and extra events", got)
+	}
+}
+
+func TestDiffAnonymousEvents(t *testing.T) {
+	a := []Event{Event{Data: []byte("x")}, Event{Data: []byte("y")}}
+	b := []Event{Event{Data: []byte("x")}, Event{Data: []byte("z")}}
+
+	got := Diff(a, b, 0)
+	if len(got) != 1 || got[0].Kind != Different || got[0].Key != "#1" {
+		t.Errorf("Got divergences %v, wanted only #1 to differ", got)
+	}
+}
@@ -0,0 +1,70 @@
+package evsrc
+
+import (
+	"bufio"
+	"io"
+	"time"
+)
+
+// An Encoder writes Events to an io.Writer in the event stream format, without
+// any HTTP machinery, for streams over pipes, sockets, or files. If the
+// io.Writer is an http.Flusher, it is flushed after each Event. Encoders write
+// Events as ServerConns with default settings do.
+//
+// Encoders are safe for concurrent use.
+type Encoder struct {
+	conn *ServerConn
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{conn: &ServerConn{w: w}}
+}
+
+// Encode writes e to the stream. As with ServerConn.Send, the zero Event is
+// written as a keepalive comment.
+func (enc *Encoder) Encode(e Event) error {
+	return enc.conn.Send(e)
+}
+
+// EncodeComment writes a comment to the stream, as ServerConn.SendComment
+// does.
+func (enc *Encoder) EncodeComment(text string) error {
+	return enc.conn.SendComment(text)
+}
+
+// SetWriteDeadline sets the deadline for writes to the stream, as
+// ServerConn.SetWriteDeadline does. The io.Writer must have a SetWriteDeadline
+// method, as net.Conn and *os.File do, or a *CapabilityError is returned.
+func (enc *Encoder) SetWriteDeadline(t time.Time) error {
+	return enc.conn.SetWriteDeadline(t)
+}
+
+// A Decoder reads Events in the event stream format from an io.Reader,
+// without any HTTP machinery. It parses exactly as ClientConn does.
+//
+// Decoders are not safe for concurrent use.
+type Decoder struct {
+	conn *ClientConn
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{conn: &ClientConn{br: br}}
+}
+
+// Decode reads the next Event from the stream. The Event's Data is owned by
+// the caller. At the end of the stream, Decode returns io.EOF.
+func (dec *Decoder) Decode() (Event, error) {
+	return dec.conn.ReceiveOwned()
+}
+
+// LastEventID returns the last Event ID read from the stream, which may have
+// been set by an Event without Data.
+func (dec *Decoder) LastEventID() string {
+	return dec.conn.LastEventID
+}
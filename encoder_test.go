@@ -0,0 +1,42 @@
+package evsrc
+
+import (
+	"io"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	r, w := io.Pipe()
+	enc := NewEncoder(w)
+
+	want := []Event{
+		{Event: "a", Data: []byte("one\ntwo"), ID: "1"},
+		{Data: []byte{}},
+		{Data: []byte("x"), ContentType: TextContentType},
+	}
+	go func() {
+		enc.EncodeComment("hello")
+		for _, e := range want {
+			enc.Encode(e)
+		}
+		enc.Encode(Event{})
+		w.Close()
+	}()
+
+	dec := NewDecoder(r)
+	for _, wantEvent := range want {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Eq(wantEvent) {
+			t.Errorf("Got %#v, wanted %#v", got, wantEvent)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("Got error %v at the end of the stream, wanted io.EOF", err)
+	}
+	if id := dec.LastEventID(); id != "1" {
+		t.Errorf("Got LastEventID %#v, wanted %#v", id, "1")
+	}
+}
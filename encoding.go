@@ -0,0 +1,54 @@
+package evsrc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// encodingField is the extension field naming how an Event's Data was
+// encoded by a ServerConn with CompressAbove set.
+const encodingField = "encoding"
+
+// gzipBase64Encoding is the only encoding written by ServerConn: the Data is
+// gzip compressed, then standard base64 encoded so that it is safe to send.
+const gzipBase64Encoding = "gzip+base64"
+
+func encodeData(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(compressed.Len()))
+	base64.StdEncoding.Encode(encoded, compressed.Bytes())
+	return encoded, nil
+}
+
+func decodeData(encoding string, data []byte, maxSize int) ([]byte, error) {
+	if encoding != gzipBase64Encoding {
+		return nil, fmt.Errorf("unknown event data encoding %q", encoding)
+	}
+
+	zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(zr, int64(maxSize)))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) >= maxSize {
+		return nil, errEventDataTooBig
+	}
+	return decoded, nil
+}
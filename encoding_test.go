@@ -0,0 +1,86 @@
+package evsrc
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressedData(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s, err := NewServerConn(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CompressAbove = 100
+
+	big := Event{Event: "big", Data: []byte(strings.Repeat("line of text\n", 1000))}
+	small := Event{Event: "small", Data: []byte("tiny")}
+	for _, ev := range []Event{big, small} {
+		err = s.Send(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw := rec.Body.Bytes()
+	if bytes.Count(raw, []byte("encoding: gzip+base64\n")) != 1 {
+		t.Errorf("wanted exactly one compressed Event, got:\n%s", raw)
+	}
+	if len(raw) > len(big.Data)/10 {
+		t.Errorf("compressed stream is %v bytes, wanted much less than %v", len(raw), len(big.Data))
+	}
+
+	client, _ := NewClientConn(bufio.NewReader(bytes.NewReader(raw)))
+	client.DecodeData = true
+	for _, want := range []Event{big, small} {
+		ev, err := client.ReceiveOwned()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ev.Eq(want) {
+			t.Errorf("Got event %q with %v bytes of Data, wanted %q with %v", ev.Event, len(ev.Data), want.Event, len(want.Data))
+		}
+	}
+	if client.Stats().UnknownFields != 0 {
+		t.Errorf("decoding client counted %v unknown fields", client.Stats().UnknownFields)
+	}
+
+	// Without DecodeData, the Data is left encoded and the field is unknown.
+	var unknown []string
+	client, _ = NewClientConn(bufio.NewReader(bytes.NewReader(raw)))
+	client.OnUnknownField = func(name, value []byte) {
+		unknown = append(unknown, string(name)+"="+string(value))
+	}
+	ev, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ev.Data, []byte("line of text")) {
+		t.Errorf("non-decoding client decoded the Data")
+	}
+	if len(unknown) != 1 || unknown[0] != "encoding=gzip+base64" {
+		t.Errorf("got unknown fields %q, wanted only the encoding", unknown)
+	}
+}
+
+func TestCompressedDataUnknownEncoding(t *testing.T) {
+	client, _ := NewClientConn(bufio.NewReader(strings.NewReader(
+		"encoding: zstd\ndata: xxx\n\ndata: next\n\n")))
+	client.DecodeData = true
+
+	_, err := client.ReceiveOwned()
+	if err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Errorf("Got err = %v, wanted an unknown encoding error", err)
+	}
+
+	ev, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Eq(Event{Data: []byte("next")}) {
+		t.Errorf("Got event %#v after the bad one, wanted Data next", ev)
+	}
+}
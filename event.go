@@ -10,8 +10,31 @@ type Event struct {
 	Data  []byte
 	ID    string
 	Retry int
+
+	// ContentType, if set, is the MIME type of Data, such as
+	// "application/json". It is sent in a content-type extension field, so
+	// that consumers of streams mixing several kinds of payload can choose how
+	// to decode each Event without sniffing its Data. Clients that don't
+	// understand the field ignore it.
+	ContentType string
+}
+
+// Clone returns a copy of e that does not share its Data with e. Events
+// returned by ClientConn.Receive may alias a reused buffer; Clone them before
+// keeping them past the next call to Receive.
+func (e Event) Clone() Event {
+	if e.Data != nil {
+		e.Data = append(make([]byte, 0, len(e.Data)), e.Data...)
+	}
+	return e
+}
+
+// IsDone reports whether e marks the clean end of a stream, as sent by
+// ServerConn.SendDone.
+func (e Event) IsDone() bool {
+	return e.Event == DoneEventName
 }
 
 func (e Event) isZero() bool {
-	return e.Event == "" && e.Data == nil && e.ID == "" && e.Retry == 0
+	return e.Event == "" && e.Data == nil && e.ID == "" && e.Retry == 0 && e.ContentType == ""
 }
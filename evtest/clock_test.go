@@ -0,0 +1,69 @@
+package evtest
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+var _ evsrc.Clock = (*Clock)(nil)
+
+func TestClockAfter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	ch := c.After(time.Second)
+	if c.Waiters() != 1 {
+		t.Errorf("Got %v waiters, wanted 1", c.Waiters())
+	}
+
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("After fired early")
+	default:
+	}
+
+	c.Advance(time.Millisecond)
+	select {
+	case got := <-ch:
+		if !got.Equal(start.Add(time.Second)) {
+			t.Errorf("After sent %v, wanted %v", got, start.Add(time.Second))
+		}
+	default:
+		t.Fatal("After did not fire")
+	}
+
+	if c.Waiters() != 0 {
+		t.Errorf("Got %v waiters, wanted 0", c.Waiters())
+	}
+}
+
+func TestClockDrivesStats(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	r := NewReader(strings.NewReader("data: a\n\n"), Conditions{
+		Latency: time.Minute,
+		Sleep:   c.Sleep,
+	})
+
+	conn, err := evsrc.NewClientConn(bufio.NewReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Clock = c
+
+	_, err = conn.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := start.Add(time.Minute)
+	if got := conn.Stats().LastActivity; !got.Equal(want) {
+		t.Errorf("Got LastActivity %v, wanted %v", got, want)
+	}
+}
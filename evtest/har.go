@@ -0,0 +1,182 @@
+package evtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A Capture is a recorded event stream response, such as one captured by a
+// browser's developer tools.
+type Capture struct {
+	// URL is the URL the stream was requested from.
+	URL string
+
+	// Started is when the request was made.
+	Started time.Time
+
+	// Body is the raw event stream, which can be parsed with an
+	// evsrc.ClientConn.
+	Body []byte
+}
+
+// The subset of the HAR 1.2 format used by ReadHAR and WriteHAR.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harHeader `json:"cookies"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harHeader `json:"cookies"`
+	Headers     []harHeader `json:"headers"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ReadHAR returns the event stream responses recorded in a HAR file, such as
+// one exported from a browser's developer tools, in the order they appear.
+// Entries whose responses are not text/event-stream, or were recorded without
+// their content, are skipped.
+func ReadHAR(r io.Reader) ([]Capture, error) {
+	var har harFile
+	err := json.NewDecoder(r).Decode(&har)
+	if err != nil {
+		return nil, err
+	}
+
+	var captures []Capture
+	for _, entry := range har.Log.Entries {
+		content := entry.Response.Content
+		mediaType, _, _ := mime.ParseMediaType(content.MimeType)
+		if mediaType != "text/event-stream" || content.Text == "" {
+			continue
+		}
+
+		body := []byte(content.Text)
+		if strings.EqualFold(content.Encoding, "base64") {
+			body, err = base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		captures = append(captures, Capture{
+			URL:     entry.Request.URL,
+			Started: entry.StartedDateTime,
+			Body:    body,
+		})
+	}
+
+	return captures, nil
+}
+
+// WriteHAR writes captures as a HAR file with one GET entry per Capture, which
+// can be loaded by browser developer tools and other HAR viewers, and read
+// back with ReadHAR.
+func WriteHAR(w io.Writer, captures []Capture) error {
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "evtest", Version: "1"},
+		Entries: []harEntry{},
+	}}
+
+	for _, c := range captures {
+		content := harContent{
+			Size:     len(c.Body),
+			MimeType: "text/event-stream",
+			Text:     string(c.Body),
+		}
+		if !utf8.Valid(c.Body) {
+			// JSON strings can only hold text.
+			content.Text = base64.StdEncoding.EncodeToString(c.Body)
+			content.Encoding = "base64"
+		}
+
+		har.Log.Entries = append(har.Log.Entries, harEntry{
+			StartedDateTime: c.Started,
+			Time:            -1,
+			Request: harRequest{
+				Method:      "GET",
+				URL:         c.URL,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harHeader{},
+				Headers:     []harHeader{{"Accept", "text/event-stream"}},
+				QueryString: []harHeader{},
+				HeadersSize: -1,
+				BodySize:    0,
+			},
+			Response: harResponse{
+				Status:      200,
+				StatusText:  "OK",
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harHeader{},
+				Headers:     []harHeader{{"Content-Type", "text/event-stream"}},
+				Content:     content,
+				HeadersSize: -1,
+				BodySize:    len(c.Body),
+			},
+			Timings: harTimings{Send: 0, Wait: -1, Receive: -1},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(har)
+}
@@ -0,0 +1,68 @@
+package evtest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHARRoundTrip(t *testing.T) {
+	captures := []Capture{
+		{
+			URL:     "https://example.com/events",
+			Started: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Body:    []byte("id: 1\ndata: hello\n\n"),
+		},
+		{
+			URL:     "https://example.com/other",
+			Started: time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC),
+			Body:    []byte("data: \xff binary\n\n"),
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteHAR(&buf, captures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadHAR(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, captures) {
+		t.Errorf("Got %#v,\nwanted %#v", got, captures)
+	}
+}
+
+func TestReadHAR(t *testing.T) {
+	har := `{"log": {"version": "1.2", "entries": [
+		{"startedDateTime": "2020-01-02T03:04:05.000Z",
+		 "request": {"method": "GET", "url": "https://example.com/page"},
+		 "response": {"status": 200, "content": {"mimeType": "text/html", "text": "<html>"}}},
+		{"startedDateTime": "2020-01-02T03:04:06.000Z",
+		 "request": {"method": "GET", "url": "https://example.com/events"},
+		 "response": {"status": 200, "content": {"mimeType": "text/event-stream; charset=utf-8",
+		  "text": "ZGF0YTogaGkKCg==", "encoding": "base64"}}},
+		{"startedDateTime": "2020-01-02T03:04:07.000Z",
+		 "request": {"method": "GET", "url": "https://example.com/empty"},
+		 "response": {"status": 200, "content": {"mimeType": "text/event-stream"}}}
+	]}}`
+
+	got, err := ReadHAR(strings.NewReader(har))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Capture{{
+		URL:     "https://example.com/events",
+		Started: time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC),
+		Body:    []byte("data: hi\n\n"),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %#v,\nwanted %#v", got, want)
+	}
+}
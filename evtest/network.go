@@ -0,0 +1,116 @@
+// Package evtest provides helpers for testing code built on evsrc.
+package evtest
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrDisconnected is returned by a Reader once its DisconnectAfter limit has
+// been reached.
+var ErrDisconnected = errors.New("evtest: simulated disconnect")
+
+// Conditions describes how a Reader misbehaves. The zero Conditions pass data
+// through unchanged. All behavior is deterministic, so a given stream and
+// Conditions always produce the same sequence of reads.
+type Conditions struct {
+	// Latency is how long each Read waits before reading.
+	Latency time.Duration
+
+	// ChunkSize, if positive, is the most bytes returned by a single Read.
+	ChunkSize int
+
+	// DisconnectAfter, if positive, is the number of bytes of the underlying
+	// stream passed through before every Read fails with ErrDisconnected.
+	DisconnectAfter int
+
+	// StallAfter and StallFor make the Reader wait for StallFor once, after
+	// StallAfter bytes of the underlying stream have been passed through.
+	StallAfter int
+	StallFor   time.Duration
+
+	// Garbage, if GarbageEvery is positive, is inserted into the stream after
+	// every GarbageEvery bytes of the underlying stream.
+	Garbage      []byte
+	GarbageEvery int
+
+	// Sleep is used to wait for Latency and StallFor. If nil, time.Sleep is
+	// used.
+	Sleep func(time.Duration)
+}
+
+// A Reader wraps an io.Reader, simulating poor network conditions.
+type Reader struct {
+	r io.Reader
+	c Conditions
+
+	passed  int // bytes of r passed through so far
+	stalled bool
+	garbage []byte // garbage waiting to be returned
+}
+
+// NewReader returns a Reader that reads from r under the given Conditions.
+func NewReader(r io.Reader, c Conditions) *Reader {
+	if c.Sleep == nil {
+		c.Sleep = time.Sleep
+	}
+	return &Reader{r: r, c: c}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	limit := len(p)
+	if r.c.ChunkSize > 0 && r.c.ChunkSize < limit {
+		limit = r.c.ChunkSize
+	}
+
+	if len(r.garbage) > 0 {
+		n := copy(p[:limit], r.garbage)
+		r.garbage = r.garbage[n:]
+		return n, nil
+	}
+
+	if r.c.DisconnectAfter > 0 {
+		left := r.c.DisconnectAfter - r.passed
+		if left <= 0 {
+			return 0, ErrDisconnected
+		}
+		if left < limit {
+			limit = left
+		}
+	}
+
+	if r.c.Latency > 0 {
+		r.c.Sleep(r.c.Latency)
+	}
+
+	if r.c.StallFor > 0 && !r.stalled {
+		if r.passed >= r.c.StallAfter {
+			r.c.Sleep(r.c.StallFor)
+			r.stalled = true
+		} else if left := r.c.StallAfter - r.passed; left < limit {
+			limit = left
+		}
+	}
+
+	if r.c.GarbageEvery > 0 {
+		left := r.c.GarbageEvery - r.passed%r.c.GarbageEvery
+		if left < limit {
+			limit = left
+		}
+	}
+
+	n, err := r.r.Read(p[:limit])
+	r.passed += n
+
+	if r.c.GarbageEvery > 0 && n > 0 && r.passed%r.c.GarbageEvery == 0 {
+		r.garbage = r.c.Garbage
+	}
+
+	return n, err
+}
@@ -0,0 +1,114 @@
+package evtest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+func TestReaderChunks(t *testing.T) {
+	r := NewReader(strings.NewReader("abcdefg"), Conditions{ChunkSize: 3})
+
+	var reads []string
+	buf := make([]byte, 100)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			reads = append(reads, string(buf[:n]))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"abc", "def", "g"}
+	if strings.Join(reads, ",") != strings.Join(want, ",") {
+		t.Errorf("Got reads %v, wanted %v", reads, want)
+	}
+}
+
+func TestReaderDisconnects(t *testing.T) {
+	r := NewReader(strings.NewReader("data: one\n\ndata: two\n\n"), Conditions{DisconnectAfter: 15})
+
+	got, err := io.ReadAll(r)
+	if err != ErrDisconnected {
+		t.Errorf("Got err = %v, wanted %v", err, ErrDisconnected)
+	}
+	if string(got) != "data: one\n\ndata" {
+		t.Errorf("Got %#v before the disconnect", string(got))
+	}
+}
+
+func TestReaderStallsAndDelays(t *testing.T) {
+	var slept []time.Duration
+	r := NewReader(strings.NewReader("abcdef"), Conditions{
+		ChunkSize:  2,
+		Latency:    time.Millisecond,
+		StallAfter: 3,
+		StallFor:   time.Minute,
+		Sleep:      func(d time.Duration) { slept = append(slept, d) },
+	})
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcdef" {
+		t.Errorf("Got %#v, wanted \"abcdef\"", string(got))
+	}
+
+	stalls := 0
+	for _, d := range slept {
+		if d == time.Minute {
+			stalls++
+		}
+	}
+	if stalls != 1 {
+		t.Errorf("Got %v stalls, wanted 1 (slept %v)", stalls, slept)
+	}
+}
+
+func TestReaderGarbageDoesNotBreakClientConn(t *testing.T) {
+	var stream bytes.Buffer
+	for i := 0; i < 20; i++ {
+		stream.WriteString("data: message\n\n")
+	}
+
+	r := NewReader(&stream, Conditions{
+		ChunkSize:    1,
+		Garbage:      []byte("\n:garbage\nbogus\n"),
+		GarbageEvery: len("data: message\n\n"),
+	})
+
+	conn, err := evsrc.NewClientConn(bufio.NewReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for {
+		ev, err := conn.Receive(nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(ev.Data) != "message" {
+			t.Errorf("Got data %#v, wanted \"message\"", string(ev.Data))
+		}
+		count++
+	}
+
+	if count != 20 {
+		t.Errorf("Got %v events, wanted 20", count)
+	}
+}
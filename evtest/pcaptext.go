@@ -0,0 +1,134 @@
+package evtest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pcapTextPacketSize is the most body bytes WritePcapText puts in each
+// packet, so that each fits in a TCP segment when text2pcap adds headers.
+const pcapTextPacketSize = 1460
+
+// pcapTextComment starts the comment line WritePcapText writes before each
+// Capture, which text2pcap ignores.
+const pcapTextComment = "# evtest capture "
+
+// WritePcapText writes captures as a pcap-text hex dump, the format read by
+// Wireshark's text2pcap (for example with "text2pcap -T 80,1234" to wrap the
+// bytes in TCP headers), and read back by ReadPcapText. Each Capture's body
+// is split into packets of up to 1460 bytes, preceded by a comment line
+// holding its URL and start time.
+func WritePcapText(w io.Writer, captures []Capture) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range captures {
+		fmt.Fprintf(bw, "%s%s %s\n", pcapTextComment, c.Started.Format(time.RFC3339Nano), c.URL)
+
+		for len(c.Body) > 0 {
+			packet := c.Body
+			if len(packet) > pcapTextPacketSize {
+				packet = packet[:pcapTextPacketSize]
+			}
+			c.Body = c.Body[len(packet):]
+
+			for offset := 0; offset < len(packet); offset += 16 {
+				line := packet[offset:]
+				if len(line) > 16 {
+					line = line[:16]
+				}
+
+				fmt.Fprintf(bw, "%06x ", offset)
+				for _, b := range line {
+					fmt.Fprintf(bw, " %02x", b)
+				}
+				bw.WriteString("\n")
+			}
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// ReadPcapText returns the event stream responses in a pcap-text hex dump, as
+// written by WritePcapText. A packet starts at each line with offset zero,
+// and the packets after each comment line written by WritePcapText are joined
+// into one Capture's body.
+//
+// Other hex dumps, such as those written by "od -Ax -tx1 -v" or copied from
+// Wireshark, are read as a single Capture with no URL. Text after the 16th
+// byte of a line, its first field that isn't a hex byte, or a gap of three or
+// more spaces, such as an ASCII column, is ignored, as are other lines
+// starting with '#'.
+func ReadPcapText(r io.Reader) ([]Capture, error) {
+	var captures []Capture
+	var current *Capture
+	packetLen := 0
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if !strings.HasPrefix(line, pcapTextComment) {
+				continue
+			}
+			started, url, _ := strings.Cut(strings.TrimPrefix(line, pcapTextComment), " ")
+			t, err := time.Parse(time.RFC3339Nano, started)
+			if err != nil {
+				return nil, fmt.Errorf("pcap-text line %d: %v", lineNum, err)
+			}
+			captures = append(captures, Capture{URL: url, Started: t})
+			current = &captures[len(captures)-1]
+			packetLen = 0
+			continue
+		}
+
+		offsetField, rest, _ := strings.Cut(line, " ")
+		offset, err := strconv.ParseUint(offsetField, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("pcap-text line %d: invalid offset %q", lineNum, offsetField)
+		}
+		if offset == 0 {
+			packetLen = 0
+		}
+		if int(offset) != packetLen {
+			return nil, fmt.Errorf("pcap-text line %d: offset %#x, wanted %#x", lineNum, offset, packetLen)
+		}
+
+		if current == nil {
+			captures = append(captures, Capture{})
+			current = &captures[len(captures)-1]
+		}
+		for _, field := range pcapTextBytes(rest) {
+			b, err := hex.DecodeString(field)
+			if err != nil || len(b) != 1 || int(offset)+16 <= packetLen {
+				break
+			}
+			current.Body = append(current.Body, b[0])
+			packetLen++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return captures, nil
+}
+
+// pcapTextBytes returns the fields of the hex bytes part of a line after its
+// offset, which ends at any gap of three or more spaces, where Wireshark
+// starts its ASCII column.
+func pcapTextBytes(s string) []string {
+	s = strings.TrimLeft(s, " \t")
+	if i := strings.Index(s, "   "); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Fields(s)
+}
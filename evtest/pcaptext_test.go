@@ -0,0 +1,80 @@
+package evtest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPcapTextRoundTrip(t *testing.T) {
+	long := bytes.Repeat([]byte("data: 0123456789\n\n"), 200)
+	captures := []Capture{
+		{
+			URL:     "https://example.com/events",
+			Started: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+			Body:    []byte("id: 1\ndata: hello\n\n"),
+		},
+		{
+			URL:     "https://example.com/long",
+			Started: time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC),
+			Body:    append(long, "data: \xff binary\n\n"...),
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WritePcapText(&buf, captures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "# evtest capture 2020-01-02T03:04:05.000000006Z https://example.com/events\n000000  69 64 3a 20 31 0a") {
+		t.Errorf("Got unexpected pcap-text %q", buf.String()[:100])
+	}
+	if n := strings.Count(buf.String(), "\n000000 "); n != 1+(len(captures[1].Body)+1459)/1460 {
+		t.Errorf("Got %v packets", n)
+	}
+
+	got, err := ReadPcapText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, captures) {
+		t.Errorf("Got %#v,\nwanted %#v", got, captures)
+	}
+}
+
+func TestReadPcapText(t *testing.T) {
+	// A Wireshark-style dump, with an ASCII column, of two packets.
+	dump := `# not a capture header
+0000  64 61 74 61 3a 20 68 69 0a 0a 64 61 74 61 3a 20   data: hi..data: 
+0010  61 62                                             ab
+
+0000  0a 0a                                             ..
+`
+
+	got, err := ReadPcapText(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Capture{{Body: []byte("data: hi\n\ndata: ab\n\n")}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %#v, wanted %#v", got, want)
+	}
+
+	// An od dump ends with a line holding only the final offset.
+	got, err = ReadPcapText(strings.NewReader("000000 64 61 74 61 3a 20 78 0a 0a\n000009\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || string(got[0].Body) != "data: x\n\n" {
+		t.Errorf("Got %#v from an od dump", got)
+	}
+
+	_, err = ReadPcapText(strings.NewReader("0000  61 62\n0004  63\n"))
+	if err == nil {
+		t.Errorf("ReadPcapText accepted a line at the wrong offset")
+	}
+}
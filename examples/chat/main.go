@@ -0,0 +1,150 @@
+// Command chat is an example of broadcasting messages to many clients with an
+// evsrc.Broker, using a ReplayBuffer so that reconnecting clients don't miss
+// messages, and of following the chat from a Go evsrc.Client.
+//
+// Run it with no arguments to serve the chat on :8080, then open
+// http://localhost:8080/ in a few browser windows, or run it with -follow to
+// print messages as they arrive. Send messages from the browser, or with
+//
+//	curl -d name=me -d text=hello http://localhost:8080/send
+//
+// The Broker's counters are served as JSON at /stats.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+type message struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+type chat struct {
+	broker *evsrc.Broker
+
+	mu     sync.Mutex
+	nextID int
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to serve on, or to follow with -follow")
+	follow := flag.Bool("follow", false, "follow a running server's chat instead of serving it")
+	flag.Parse()
+
+	if *follow {
+		err := followChat("http://" + *addr + "/events")
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	c := &chat{broker: evsrc.NewBroker()}
+	c.broker.Replay = evsrc.NewReplayBuffer(100, 10*time.Minute)
+
+	http.HandleFunc("/", servePage)
+	http.HandleFunc("/send", c.serveSend)
+	http.HandleFunc("/events", c.serveEvents)
+	http.HandleFunc("/stats", c.serveStats)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func (c *chat) serveSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.Marshal(message{Name: r.FormValue("name"), Text: r.FormValue("text")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// IDs must be published in order, so that clients resume from the right
+	// place.
+	c.mu.Lock()
+	c.nextID++
+	c.broker.Publish(evsrc.Event{ID: strconv.Itoa(c.nextID), Event: "message", Data: data})
+	c.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *chat) serveEvents(w http.ResponseWriter, r *http.Request) {
+	err := c.broker.Subscribe(w, r)
+	if err != nil {
+		log.Printf("chat stream for %v ended: %v", r.RemoteAddr, err)
+	}
+}
+
+func (c *chat) serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.broker.Stats())
+}
+
+func followChat(url string) error {
+	client := &evsrc.Client{URL: url}
+	return client.Run(context.Background(), func(ev evsrc.Event) error {
+		switch ev.Event {
+		case "message":
+			var m message
+			err := json.Unmarshal(ev.Data, &m)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("<%s> %s\n", m.Name, m.Text)
+
+		case evsrc.ResumeLostEvent:
+			fmt.Println("(some messages were missed while disconnected)")
+		}
+		return nil
+	})
+}
+
+func servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+const page = `<!DOCTYPE html>
+<title>evsrc chat</title>
+<ul id="log"></ul>
+<form id="send">
+  <input name="name" placeholder="name" size="10">
+  <input name="text" placeholder="message" size="40" autofocus>
+  <button>Send</button>
+</form>
+<script>
+const log = document.getElementById("log");
+const form = document.getElementById("send");
+
+new EventSource("/events").addEventListener("message", (e) => {
+  const m = JSON.parse(e.data);
+  const li = document.createElement("li");
+  li.textContent = "<" + m.name + "> " + m.text;
+  log.appendChild(li);
+});
+
+form.addEventListener("submit", (e) => {
+  e.preventDefault();
+  fetch("/send", {method: "POST", body: new URLSearchParams(new FormData(form))});
+  form.text.value = "";
+});
+</script>
+`
@@ -0,0 +1,212 @@
+// Command llmrelay is an example of relaying the tokens of a streaming LLM
+// completion to browsers: it requests an OpenAI-style streaming completion,
+// decodes the upstream stream with llmstream, and forwards each piece of text
+// as a "token" Event with evsrc.StreamFunc.
+//
+// Run it with no arguments to serve the relay on :8080 in front of a built-in
+// fake model, then open http://localhost:8080/chat?prompt=hello in a browser
+// (or curl it), or run it with -follow to print a completion from the
+// included client. Set -upstream to the chat completions URL of a real API,
+// such as https://api.openai.com/v1/chat/completions, with its key in the
+// OPENAI_API_KEY environment variable, to relay a real model.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/encryptio/go-evsrc"
+	"github.com/encryptio/go-evsrc/llmstream"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to serve on, or to follow with -follow")
+	upstream := flag.String("upstream", "", "chat completions URL to relay; if empty, a fake model is served at /fake")
+	model := flag.String("model", "gpt-4o-mini", "model to request from the upstream")
+	follow := flag.String("follow", "", "print the relayed completion of this prompt from a running server instead of serving")
+	flag.Parse()
+
+	if *follow != "" {
+		err := followChat("http://" + *addr + "/chat?prompt=" + url.QueryEscape(*follow))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *upstream == "" {
+		*upstream = "http://" + *addr + "/fake"
+		http.HandleFunc("/fake", serveFakeModel)
+	}
+
+	r := &relay{upstream: *upstream, model: *model, apiKey: os.Getenv("OPENAI_API_KEY")}
+	http.HandleFunc("/chat", r.serveChat)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+type relay struct {
+	upstream string
+	model    string
+	apiKey   string
+}
+
+func (rl *relay) serveChat(w http.ResponseWriter, r *http.Request) {
+	prompt := r.FormValue("prompt")
+
+	err := evsrc.StreamFunc(w, r, func(send func(evsrc.Event) error) error {
+		resp, err := rl.request(r, prompt)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		conn, err := evsrc.NewClientConn(bufio.NewReader(resp.Body))
+		if err != nil {
+			return err
+		}
+
+		for {
+			ev, err := conn.ReceiveOwned()
+			if err == io.EOF {
+				return fmt.Errorf("upstream stream ended early")
+			}
+			if err != nil {
+				return err
+			}
+			if llmstream.IsDone(ev) {
+				return nil
+			}
+
+			d, ok, err := llmstream.ParseDelta(ev)
+			if err != nil {
+				return err
+			}
+			if !ok || d.Text == "" {
+				continue
+			}
+
+			err = send(evsrc.Event{Event: "token", Data: []byte(d.Text)})
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("relay for %v ended: %v", r.RemoteAddr, err)
+	}
+}
+
+// request starts a streaming completion of prompt, canceled along with r.
+func (rl *relay) request(r *http.Request, prompt string) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    rl.model,
+		"stream":   true,
+		"messages": []map[string]string{{"role": "user", "content": prompt}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), "POST", rl.upstream, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if rl.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+rl.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream responded with status %v", resp.Status)
+	}
+	return resp, nil
+}
+
+// serveFakeModel streams a canned completion in the OpenAI format, a word at
+// a time.
+func serveFakeModel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	prompt := ""
+	if len(req.Messages) > 0 {
+		prompt = req.Messages[len(req.Messages)-1].Content
+	}
+	reply := fmt.Sprintf("You said %q, which is %d characters long.", prompt, len(prompt))
+
+	conn, err := evsrc.NewServerConn(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i, word := range strings.SplitAfter(reply, " ") {
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		content, _ := json.Marshal(word)
+		chunk := fmt.Sprintf(`{"choices":[{"delta":{"content":%s}}]}`, content)
+		if conn.Send(evsrc.Event{Data: []byte(chunk)}) != nil {
+			return
+		}
+	}
+	conn.Send(evsrc.Event{Data: []byte(`{"choices":[{"delta":{},"finish_reason":"stop"}]}`)})
+	conn.Send(evsrc.Event{Data: []byte(llmstream.DoneSentinel)})
+}
+
+func followChat(url string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got response status %v", resp.Status)
+	}
+
+	conn, err := evsrc.NewClientConn(bufio.NewReader(resp.Body))
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := conn.ReceiveOwned()
+		if err == io.EOF {
+			return fmt.Errorf("stream ended before the completion finished")
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ev.IsDone():
+			fmt.Println()
+			return nil
+		case ev.Err() != nil:
+			return ev.Err()
+		case ev.Event == "token":
+			fmt.Printf("%s", ev.Data)
+		}
+	}
+}
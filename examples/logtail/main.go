@@ -0,0 +1,81 @@
+// Command logtail is an example of streaming a growing log file to many
+// clients: an evsrc.Follower turns new lines into Events, which are published
+// to an evsrc.Broker with a ReplayBuffer, so that clients that reconnect pick
+// up where they left off.
+//
+// Run it with -file set to a log file to serve it on :8080, then open
+// http://localhost:8080/log in a browser (or curl it), or run it with -follow
+// to print the lines from the included client.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to serve on, or to follow with -follow")
+	file := flag.String("file", "", "log file to serve")
+	follow := flag.Bool("follow", false, "follow a running server's log instead of serving it")
+	flag.Parse()
+
+	if *follow {
+		err := followLog("http://" + *addr + "/log")
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+
+	broker := evsrc.NewBroker()
+	broker.Replay = evsrc.NewReplayBuffer(1000, 0)
+
+	// LineToEvent is called for each line in order, so it can number them.
+	lines := 0
+	t := evsrc.Follower{
+		Path: *file,
+		LineToEvent: func(line []byte) evsrc.Event {
+			lines++
+			return evsrc.Event{ID: strconv.Itoa(lines), Data: line}
+		},
+	}.Start()
+	defer t.Stop()
+
+	go func() {
+		for ev := range t.Events() {
+			broker.Publish(ev)
+		}
+		log.Printf("stopped following %v: %v", *file, t.Err())
+		broker.Close()
+	}()
+
+	http.HandleFunc("/log", func(w http.ResponseWriter, r *http.Request) {
+		err := broker.Subscribe(w, r)
+		if err != nil {
+			log.Printf("log stream for %v ended: %v", r.RemoteAddr, err)
+		}
+	})
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func followLog(url string) error {
+	client := &evsrc.Client{URL: url}
+	return client.Run(context.Background(), func(ev evsrc.Event) error {
+		if ev.Event == evsrc.ResumeLostEvent {
+			fmt.Println("... lines missed while disconnected ...")
+			return nil
+		}
+		fmt.Printf("%s\n", ev.Data)
+		return nil
+	})
+}
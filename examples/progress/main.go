@@ -0,0 +1,110 @@
+// Command progress is an example of streaming the progress of a long-running
+// job with evsrc.StreamFunc, and of following it from a Go client.
+//
+// Run it with no arguments to serve the job on :8080, then open
+// http://localhost:8080/job in a browser (or curl it), or run it with -follow
+// to watch the job from the included client.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to serve on, or to follow with -follow")
+	follow := flag.Bool("follow", false, "follow a running server's job instead of serving it")
+	flag.Parse()
+
+	if *follow {
+		err := followJob("http://" + *addr + "/job")
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	http.HandleFunc("/job", serveJob)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func serveJob(w http.ResponseWriter, r *http.Request) {
+	const steps = 10
+
+	err := evsrc.StreamFunc(w, r, func(send func(evsrc.Event) error) error {
+		start := time.Now()
+		for i := 1; i <= steps; i++ {
+			time.Sleep(300 * time.Millisecond)
+
+			elapsed := time.Since(start)
+			err := evsrc.SendProgress(send, evsrc.Progress{
+				Percent: 100 * float64(i) / steps,
+				Message: fmt.Sprintf("finished step %d of %d", i, steps),
+				ETA:     elapsed / time.Duration(i) * time.Duration(steps-i),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("job stream for %v ended: %v", r.RemoteAddr, err)
+	}
+}
+
+func followJob(url string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got response status %v", resp.Status)
+	}
+
+	conn, err := evsrc.NewClientConn(bufio.NewReader(resp.Body))
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := conn.ReceiveOwned()
+		if err == io.EOF {
+			return fmt.Errorf("stream ended before the job finished")
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ev.IsDone():
+			fmt.Println("done")
+			return nil
+
+		case ev.Err() != nil:
+			return ev.Err()
+
+		case ev.Event == evsrc.ProgressEventName:
+			p, err := evsrc.ParseProgress(ev)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%5.1f%% %s (about %v left)\n", p.Percent, p.Message, p.ETA.Round(time.Second))
+		}
+	}
+}
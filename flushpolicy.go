@@ -0,0 +1,45 @@
+package evsrc
+
+import (
+	"time"
+)
+
+// A FlushPolicy controls how often a ServerConn flushes its output to the
+// client. Flushing after every Event gives the lowest latency, but for streams
+// with many small Events, flushing less often greatly reduces the number of
+// writes and packets.
+//
+// The zero FlushPolicy flushes after every Event. Otherwise, a ServerConn
+// flushes after a send once Events sends have been made or Interval has
+// passed since the last flush, whichever comes first. Either limit may be
+// zero to not use it. Flushes only happen during sends, so with a limit set
+// the last few Events of a burst stay buffered until the next send or an
+// explicit call to ServerConn.Flush.
+type FlushPolicy struct {
+	// Events is the number of sends after which to flush.
+	Events int
+
+	// Interval is the time since the last flush after which to flush.
+	Interval time.Duration
+
+	// Manual disables flushing during sends entirely, leaving it to the
+	// caller to call ServerConn.Flush.
+	Manual bool
+}
+
+// due reports whether a ServerConn that has made unflushed sends since it
+// last flushed at lastFlush should flush now.
+func (p FlushPolicy) due(unflushed int, lastFlush, now time.Time) bool {
+	if p.Manual {
+		return false
+	}
+
+	if p.Events <= 0 && p.Interval <= 0 {
+		return true
+	}
+
+	if p.Events > 0 && unflushed >= p.Events {
+		return true
+	}
+	return p.Interval > 0 && now.Sub(lastFlush) >= p.Interval
+}
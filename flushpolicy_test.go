@@ -0,0 +1,59 @@
+package evsrc
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushCounter) Flush() {
+	f.flushes++
+}
+
+func TestFlushPolicy(t *testing.T) {
+	tests := []struct {
+		policy FlushPolicy
+		step   time.Duration
+		want   int
+	}{
+		{FlushPolicy{}, 0, 10},
+		{FlushPolicy{Events: 3}, 0, 3},
+		{FlushPolicy{Interval: time.Second}, 300 * time.Millisecond, 3},
+		{FlushPolicy{Events: 4, Interval: time.Second}, 400 * time.Millisecond, 4},
+		{FlushPolicy{Events: 1, Manual: true}, time.Second, 0},
+	}
+
+	for _, test := range tests {
+		w := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+		clock := &steppingClock{now: time.Unix(1000, 0)}
+
+		conn, err := NewServerConn(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.FlushPolicy = test.policy
+		conn.Clock = clock
+
+		for i := 0; i < 10; i++ {
+			clock.now = clock.now.Add(test.step)
+			err = conn.Send(Event{Data: []byte("x")})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if w.flushes != test.want {
+			t.Errorf("%+v flushed %v times during 10 sends, wanted %v", test.policy, w.flushes, test.want)
+		}
+
+		conn.Flush()
+		if w.flushes != test.want+1 {
+			t.Errorf("%+v: Flush did not flush", test.policy)
+		}
+	}
+}
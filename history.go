@@ -0,0 +1,126 @@
+package evsrc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// A HistoryPage is one page of the Events that preceded a stream, oldest
+// first, as fetched by History.Fetch.
+type HistoryPage struct {
+	Events []Event
+
+	// Next is the cursor of the following page, or empty if this page
+	// reaches the head of the history, where the live stream takes over.
+	Next string
+}
+
+// History describes where Client.RunHistory gets the Events that preceded
+// the live stream, such as from a paginated REST endpoint.
+type History struct {
+	// Fetch returns the page of history at cursor. The first page is
+	// fetched with an empty cursor, and each later one with the Next cursor
+	// of the page before.
+	Fetch func(ctx context.Context, cursor string) (HistoryPage, error)
+
+	// Follows reports whether next, the first Event with an ID received
+	// from the live stream, directly follows prev, the last Event of the history with an
+	// ID. If nil, Events whose IDs are both decimal integers must have
+	// consecutive IDs, and other Events are assumed to follow.
+	Follows func(prev, next Event) bool
+}
+
+func (h History) follows(prev, next Event) bool {
+	if h.Follows != nil {
+		return h.Follows(prev, next)
+	}
+
+	prevSeq, err := strconv.ParseUint(prev.ID, 10, 64)
+	if err != nil {
+		return true
+	}
+	nextSeq, err := strconv.ParseUint(next.ID, 10, 64)
+	if err != nil {
+		return true
+	}
+	return nextSeq == prevSeq+1
+}
+
+// A HistoryGapError is returned by Client.RunHistory when the live stream
+// does not continue where the history ended, so that Events may have been
+// missed or repeated between them.
+type HistoryGapError struct {
+	// LastHistoryID is the ID of the last Event of the history.
+	LastHistoryID string
+
+	// FirstLiveID is the ID of the first Event of the live stream with an
+	// ID, or empty if the stream sent a ResumeLostEvent instead.
+	FirstLiveID string
+}
+
+func (e *HistoryGapError) Error() string {
+	if e.FirstLiveID == "" {
+		return fmt.Sprintf("live stream could not resume after history ending at event %q", e.LastHistoryID)
+	}
+	return fmt.Sprintf("live stream starting at event %q does not follow history ending at event %q", e.FirstLiveID, e.LastHistoryID)
+}
+
+// RunHistory pages through h and calls handle with every Event in it, then
+// runs the live stream as Run does, resuming after the last Event of the
+// history that had an ID. This is the usual pattern for feeds and chats,
+// where the history is too long to replay over the stream itself.
+//
+// The first Event of the live stream with an ID is checked against the end of
+// the history with h.Follows. If it doesn't follow, RunHistory returns a
+// *HistoryGapError without handling it, and the caller should start over.
+// Events without IDs before it are handled as usual, except for a
+// ResumeLostEvent, sent by a Broker that no longer has the end of the history
+// to resume from, which is also reported as a *HistoryGapError.
+// Errors from h.Fetch are returned as they are, without retrying.
+func (c *Client) RunHistory(ctx context.Context, h History, handle func(Event) error) error {
+	var last Event
+	haveLast := false
+
+	cursor := ""
+	for {
+		page, err := h.Fetch(ctx, cursor)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range page.Events {
+			err := handle(e)
+			if err != nil {
+				return err
+			}
+
+			if e.ID != "" {
+				c.LastEventID = e.ID
+				last = e
+				haveLast = true
+			}
+		}
+
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+
+	checkSeam := haveLast
+	return c.Run(ctx, func(e Event) error {
+		if checkSeam {
+			if e.Event == ResumeLostEvent {
+				return &HistoryGapError{LastHistoryID: last.ID}
+			}
+			if e.ID != "" {
+				checkSeam = false
+				if !h.follows(last, e) {
+					return &HistoryGapError{LastHistoryID: last.ID, FirstLiveID: e.ID}
+				}
+			}
+		}
+		return handle(e)
+	})
+}
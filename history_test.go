@@ -0,0 +1,119 @@
+package evsrc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClientRunHistory(t *testing.T) {
+	var firstLive string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.Header.Get("Last-Event-ID"); id != "4" {
+			t.Errorf("Got Last-Event-ID %q, wanted the last history ID", id)
+		}
+
+		conn, _ := NewServerConn(w)
+		conn.Send(Event{Event: "schema", Data: []byte("v1")})
+		conn.Send(Event{ID: firstLive, Data: []byte("live")})
+		conn.SendDone()
+	}))
+	defer server.Close()
+
+	history := History{
+		Fetch: func(ctx context.Context, cursor string) (HistoryPage, error) {
+			start := 1
+			if cursor != "" {
+				start, _ = strconv.Atoi(cursor)
+			}
+
+			var page HistoryPage
+			for id := start; id < start+2; id++ {
+				page.Events = append(page.Events, Event{ID: strconv.Itoa(id), Data: []byte("old")})
+			}
+			if start == 1 {
+				page.Next = "3"
+			}
+			return page, nil
+		},
+	}
+
+	firstLive = "5"
+	client := &Client{URL: server.URL}
+	var got []string
+	err := client.RunHistory(context.Background(), history, func(e Event) error {
+		got = append(got, e.ID+"="+string(e.Data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(got, ","); s != "1=old,2=old,3=old,4=old,=v1,5=live,=" {
+		t.Errorf("Got events %q", s)
+	}
+
+	firstLive = "7"
+	client = &Client{URL: server.URL}
+	got = nil
+	err = client.RunHistory(context.Background(), history, func(e Event) error {
+		got = append(got, e.ID)
+		return nil
+	})
+	var gapErr *HistoryGapError
+	if !errors.As(err, &gapErr) || gapErr.LastHistoryID != "4" || gapErr.FirstLiveID != "7" {
+		t.Errorf("Got error %v, wanted a gap between 4 and 7", err)
+	}
+	if len(got) != 5 {
+		t.Errorf("Handled %v Events, wanted only the history and the Event without an ID", got)
+	}
+
+	history.Follows = func(prev, next Event) bool { return true }
+	client = &Client{URL: server.URL}
+	err = client.RunHistory(context.Background(), history, func(e Event) error { return nil })
+	if err != nil {
+		t.Errorf("Got error %v with Follows accepting the seam", err)
+	}
+}
+
+func TestClientRunHistoryResumeLost(t *testing.T) {
+	broker := NewBroker()
+	broker.Replay = NewReplayBuffer(2, 0)
+	for id := 1; id <= 6; id++ {
+		broker.Publish(Event{ID: strconv.Itoa(id), Data: []byte("x")})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		broker.Subscribe(w, r)
+	}))
+	defer server.Close()
+	defer broker.Close()
+
+	// The history ends at 4, which the Broker's Replay buffer has already
+	// evicted to make room for 5 and 6.
+	history := History{
+		Fetch: func(ctx context.Context, cursor string) (HistoryPage, error) {
+			var page HistoryPage
+			for id := 1; id <= 4; id++ {
+				page.Events = append(page.Events, Event{ID: strconv.Itoa(id), Data: []byte("old")})
+			}
+			return page, nil
+		},
+	}
+
+	client := &Client{URL: server.URL}
+	var got []string
+	err := client.RunHistory(context.Background(), history, func(e Event) error {
+		got = append(got, e.ID)
+		return nil
+	})
+	var gapErr *HistoryGapError
+	if !errors.As(err, &gapErr) || gapErr.LastHistoryID != "4" || gapErr.FirstLiveID != "" {
+		t.Errorf("Got error %v, wanted a gap after 4", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("Handled %v Events, wanted only the history", got)
+	}
+}
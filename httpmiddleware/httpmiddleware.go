@@ -0,0 +1,58 @@
+// Package httpmiddleware serves event streams and ordinary responses from the
+// same URLs, choosing between them by the request's Accept header.
+package httpmiddleware
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptsEventStream reports whether r's Accept header explicitly lists
+// text/event-stream with a non-zero quality. Wildcards such as */* do not
+// count, so ordinary browser navigations and API calls are not matched.
+func AcceptsEventStream(r *http.Request) bool {
+	for _, header := range r.Header["Accept"] {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mediaType != "text/event-stream" {
+				continue
+			}
+
+			if q, ok := params["q"]; ok {
+				quality, err := strconv.ParseFloat(q, 64)
+				if err != nil || quality <= 0 {
+					continue
+				}
+			}
+
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap returns a handler that serves requests accepting text/event-stream
+// from streams, if streams has a handler registered for them, and everything
+// else from next. This allows an endpoint to serve a snapshot as JSON to
+// ordinary requests and a live stream to EventSource clients at the same URL.
+//
+// Responses from both handlers get "Vary: Accept" so that caches keep them
+// apart.
+func Wrap(next http.Handler, streams *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		if AcceptsEventStream(r) {
+			// Dispatch through streams itself rather than the handler it
+			// matched, so that the request's path values are set.
+			if _, pattern := streams.Handler(r); pattern != "" {
+				streams.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
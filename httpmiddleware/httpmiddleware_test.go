@@ -0,0 +1,93 @@
+// The ServeMux patterns used here need Go 1.22 routing.
+//go:debug httpmuxgo121=0
+
+package httpmiddleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsEventStream(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"text/event-stream", true},
+		{"application/json, text/event-stream;q=0.5", true},
+		{"text/event-stream;q=0", false},
+		{"TEXT/Event-Stream", true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if got := AcceptsEventStream(r); got != test.want {
+			t.Errorf("AcceptsEventStream with Accept %#v = %v, wanted %v", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "snapshot")
+	})
+
+	streams := http.NewServeMux()
+	streams.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "stream")
+	})
+
+	h := Wrap(next, streams)
+
+	tests := []struct {
+		path   string
+		accept string
+		want   string
+	}{
+		{"/live", "application/json", "snapshot"},
+		{"/live", "text/event-stream", "stream"},
+		{"/other", "text/event-stream", "snapshot"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Body.String(); got != test.want {
+			t.Errorf("GET %v with Accept %#v got %#v, wanted %#v", test.path, test.accept, got, test.want)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("GET %v got Vary %#v, wanted \"Accept\"", test.path, got)
+		}
+	}
+}
+
+func TestWrapSetsPathValues(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "snapshot")
+	})
+
+	streams := http.NewServeMux()
+	streams.HandleFunc("GET /streams/{topic}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "topic="+r.PathValue("topic"))
+	})
+
+	r := httptest.NewRequest("GET", "/streams/news", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	Wrap(next, streams).ServeHTTP(w, r)
+
+	if got := w.Body.String(); got != "topic=news" {
+		t.Errorf("Got %#v, wanted the topic path value to reach the handler", got)
+	}
+}
@@ -0,0 +1,86 @@
+package evsrc
+
+import (
+	"strconv"
+	"sync"
+)
+
+// An IDRewriter replaces the IDs of Events from an upstream stream with IDs of
+// its own, remembering the mapping in both directions. This lets a component
+// that filters, buffers, or merges upstream streams give its own clients IDs
+// that are meaningful to it, and translate a client's Last-Event-ID back into
+// an upstream ID when resuming.
+//
+// IDRewriters are safe for concurrent use.
+type IDRewriter struct {
+	mu         sync.Mutex
+	capacity   int
+	next       uint64
+	toUpstream map[string]string
+	toLocal    map[string]string
+	order      []string // local IDs, oldest first
+}
+
+// NewIDRewriter returns an IDRewriter that remembers the most recent capacity
+// mappings.
+func NewIDRewriter(capacity int) *IDRewriter {
+	return &IDRewriter{
+		capacity:   capacity,
+		toUpstream: make(map[string]string),
+		toLocal:    make(map[string]string),
+	}
+}
+
+// Transform returns a Transform that gives every Event with an ID a new, local
+// ID. Local IDs are increasing decimal integers starting at 1.
+func (r *IDRewriter) Transform() Transform {
+	return func(e Event) (Event, bool) {
+		if e.ID != "" {
+			e.ID = r.rewrite(e.ID)
+		}
+		return e, true
+	}
+}
+
+func (r *IDRewriter) rewrite(upstream string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next++
+	local := strconv.FormatUint(r.next, 10)
+
+	r.toUpstream[local] = upstream
+	r.toLocal[upstream] = local
+	r.order = append(r.order, local)
+
+	for len(r.order) > r.capacity {
+		oldest := r.order[0]
+		r.order = r.order[1:]
+
+		up := r.toUpstream[oldest]
+		delete(r.toUpstream, oldest)
+		if r.toLocal[up] == oldest {
+			delete(r.toLocal, up)
+		}
+	}
+
+	return local
+}
+
+// Upstream returns the upstream ID that was rewritten to local, if it is still
+// remembered.
+func (r *IDRewriter) Upstream(local string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	up, ok := r.toUpstream[local]
+	return up, ok
+}
+
+// Local returns the most recent local ID given to upstream, if it is still
+// remembered.
+func (r *IDRewriter) Local(upstream string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	local, ok := r.toLocal[upstream]
+	return local, ok
+}
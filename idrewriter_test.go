@@ -0,0 +1,39 @@
+package evsrc
+
+import (
+	"testing"
+)
+
+func TestIDRewriter(t *testing.T) {
+	r := NewIDRewriter(2)
+	transform := r.Transform()
+
+	var ids []string
+	for _, up := range []string{"a", "", "b", "c"} {
+		e, ok := transform(Event{ID: up})
+		if !ok {
+			t.Fatalf("IDRewriter dropped an event")
+		}
+		ids = append(ids, e.ID)
+	}
+
+	want := []string{"1", "", "2", "3"}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("Got IDs %v, wanted %v", ids, want)
+		}
+	}
+
+	if up, ok := r.Upstream("3"); !ok || up != "c" {
+		t.Errorf("Upstream(\"3\") = %#v, %v, wanted \"c\", true", up, ok)
+	}
+	if local, ok := r.Local("b"); !ok || local != "2" {
+		t.Errorf("Local(\"b\") = %#v, %v, wanted \"2\", true", local, ok)
+	}
+	if _, ok := r.Upstream("1"); ok {
+		t.Errorf("Upstream(\"1\") still remembered past capacity")
+	}
+	if _, ok := r.Local("a"); ok {
+		t.Errorf("Local(\"a\") still remembered past capacity")
+	}
+}
@@ -0,0 +1,392 @@
+package evsrc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// A JSONAccumulator collects JSON text that arrives in arbitrary pieces, such
+// as the deltas of a token stream, and reports each top-level JSON value as
+// soon as it is complete. Values may be separated by whitespace, as in
+// newline-delimited JSON.
+//
+// The text is checked as it arrives, so invalid JSON is reported by the Write
+// that makes it invalid, and each byte is only scanned once however many
+// pieces a value arrives in.
+type JSONAccumulator struct {
+	// OnPrefix, if set, is called after each Write that extends the stable
+	// prefix of the value in progress: the text up to the end of its last
+	// complete token, which no later text can change. Consumers can use it to
+	// show a partial value early, for example by closing its open brackets.
+	// The prefix is only valid during the call. If OnPrefix returns an error,
+	// Write returns it.
+	OnPrefix func(prefix []byte) error
+
+	onValue func(json.RawMessage) error
+	buf     []byte
+	err     error
+
+	// Offsets into buf: scanned is the next byte to scan, start is the start
+	// of the value in progress (or -1), stable is the end of the stable
+	// prefix, and reported is the end of the last prefix passed to OnPrefix.
+	scanned  int
+	start    int
+	stable   int
+	reported int
+
+	// discarded is the number of bytes dropped from the front of buf, for
+	// error offsets.
+	discarded int
+
+	state   jsonScanState
+	stack   []byte // the open '{' and '[' of the value in progress
+	key     bool   // whether the string being scanned is an object key
+	unicode int    // hex digits left in a \u escape
+	literal string // bytes left in true, false, or null
+}
+
+type jsonScanState int
+
+const (
+	scanValue jsonScanState = iota
+	scanArrayStart
+	scanObjectStart
+	scanKey
+	scanColon
+	scanAfterValue
+	scanString
+	scanStringEscape
+	scanStringUnicode
+	scanLiteral
+	scanNumMinus
+	scanNumZero
+	scanNumInt
+	scanNumDot
+	scanNumFrac
+	scanNumE
+	scanNumESign
+	scanNumExp
+)
+
+// NewJSONAccumulator returns a JSONAccumulator that calls onValue with each
+// complete value, in order. The value is only valid during the call. If
+// onValue returns an error, Write returns it.
+func NewJSONAccumulator(onValue func(json.RawMessage) error) *JSONAccumulator {
+	return &JSONAccumulator{onValue: onValue, start: -1}
+}
+
+// Add writes e's Data to the JSONAccumulator.
+func (a *JSONAccumulator) Add(e Event) error {
+	_, err := a.Write(e.Data)
+	return err
+}
+
+// Write appends p to the accumulated text and reports any values it completes.
+// It returns an error if the text is not valid JSON. Once Write has returned
+// an error, it returns the same error for all later calls.
+func (a *JSONAccumulator) Write(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+
+	a.buf = append(a.buf, p...)
+	for a.scanned < len(a.buf) {
+		err := a.step(a.buf[a.scanned])
+		if err != nil {
+			a.err = err
+			return 0, err
+		}
+	}
+
+	if a.start >= 0 && a.stable > a.start && a.stable > a.reported {
+		a.reported = a.stable
+		if a.OnPrefix != nil {
+			err := a.OnPrefix(a.buf[a.start:a.stable])
+			if err != nil {
+				a.err = err
+				return 0, err
+			}
+		}
+	}
+
+	a.compact()
+	return len(p), nil
+}
+
+// compact drops the text before the value in progress, once doing so is cheap
+// compared to the text scanned since the last compaction.
+func (a *JSONAccumulator) compact() {
+	drop := a.scanned
+	if a.start >= 0 {
+		drop = a.start
+		if drop < len(a.buf)/2 {
+			return
+		}
+		a.start -= drop
+		a.stable -= drop
+		a.reported -= drop
+	}
+
+	a.buf = append(a.buf[:0], a.buf[drop:]...)
+	a.scanned -= drop
+	a.discarded += drop
+}
+
+// Buffered returns the accumulated text that is not yet part of a complete
+// value.
+func (a *JSONAccumulator) Buffered() []byte {
+	if a.start < 0 {
+		return bytes.TrimSpace(a.buf[a.scanned:])
+	}
+	return bytes.TrimSpace(a.buf[a.start:])
+}
+
+// step scans the byte c at a.scanned. It consumes c except when c ends a
+// number, in which case c is scanned again in the state after the number.
+func (a *JSONAccumulator) step(c byte) error {
+	switch a.state {
+	case scanValue, scanArrayStart:
+		if isJSONSpace(c) {
+			a.scanned++
+			return nil
+		}
+		if c == ']' && a.state == scanArrayStart {
+			return a.close(c)
+		}
+		return a.beginValue(c)
+
+	case scanObjectStart, scanKey:
+		if isJSONSpace(c) {
+			a.scanned++
+			return nil
+		}
+		if c == '}' && a.state == scanObjectStart {
+			return a.close(c)
+		}
+		if c != '"' {
+			return a.syntaxError(c, "looking for the beginning of an object key")
+		}
+		a.scanned++
+		a.key = true
+		a.state = scanString
+		return nil
+
+	case scanColon:
+		if isJSONSpace(c) {
+			a.scanned++
+			return nil
+		}
+		if c != ':' {
+			return a.syntaxError(c, "after object key")
+		}
+		a.scanned++
+		a.stable = a.scanned
+		a.state = scanValue
+		return nil
+
+	case scanAfterValue:
+		if isJSONSpace(c) {
+			a.scanned++
+			return nil
+		}
+		switch c {
+		case ',':
+			a.scanned++
+			a.stable = a.scanned
+			a.state = scanValue
+			if a.stack[len(a.stack)-1] == '{' {
+				a.state = scanKey
+			}
+			return nil
+		case '}', ']':
+			return a.close(c)
+		}
+		return a.syntaxError(c, "after value")
+
+	case scanString:
+		switch {
+		case c == '"':
+			a.scanned++
+			if a.key {
+				a.key = false
+				a.stable = a.scanned
+				a.state = scanColon
+				return nil
+			}
+			return a.endValue()
+		case c == '\\':
+			a.state = scanStringEscape
+		case c < 0x20:
+			return a.syntaxError(c, "in string literal")
+		}
+		a.scanned++
+		return nil
+
+	case scanStringEscape:
+		switch c {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			a.state = scanString
+		case 'u':
+			a.unicode = 4
+			a.state = scanStringUnicode
+		default:
+			return a.syntaxError(c, "in string escape code")
+		}
+		a.scanned++
+		return nil
+
+	case scanStringUnicode:
+		if !isHexDigit(c) {
+			return a.syntaxError(c, "in \\u hexadecimal character escape")
+		}
+		a.scanned++
+		a.unicode--
+		if a.unicode == 0 {
+			a.state = scanString
+		}
+		return nil
+
+	case scanLiteral:
+		if c != a.literal[0] {
+			return a.syntaxError(c, "in literal")
+		}
+		a.scanned++
+		a.literal = a.literal[1:]
+		if a.literal == "" {
+			return a.endValue()
+		}
+		return nil
+
+	case scanNumMinus:
+		switch {
+		case c == '0':
+			a.state = scanNumZero
+		case '1' <= c && c <= '9':
+			a.state = scanNumInt
+		default:
+			return a.syntaxError(c, "in numeric literal")
+		}
+		a.scanned++
+		return nil
+
+	case scanNumZero, scanNumInt, scanNumFrac, scanNumExp:
+		switch {
+		case isDigit(c) && a.state != scanNumZero:
+		case c == '.' && (a.state == scanNumZero || a.state == scanNumInt):
+			a.state = scanNumDot
+		case (c == 'e' || c == 'E') && a.state != scanNumExp:
+			a.state = scanNumE
+		default:
+			// The number ended at the byte before c.
+			return a.endValue()
+		}
+		a.scanned++
+		return nil
+
+	case scanNumDot:
+		if !isDigit(c) {
+			return a.syntaxError(c, "after decimal point in numeric literal")
+		}
+		a.scanned++
+		a.state = scanNumFrac
+		return nil
+
+	case scanNumE, scanNumESign:
+		switch {
+		case isDigit(c):
+			a.state = scanNumExp
+		case (c == '+' || c == '-') && a.state == scanNumE:
+			a.state = scanNumESign
+		default:
+			return a.syntaxError(c, "in exponent of numeric literal")
+		}
+		a.scanned++
+		return nil
+	}
+
+	panic("unreachable")
+}
+
+// beginValue scans c, the first byte of a value.
+func (a *JSONAccumulator) beginValue(c byte) error {
+	if len(a.stack) == 0 {
+		a.start = a.scanned
+		a.stable = a.start
+		a.reported = a.start
+	}
+
+	switch {
+	case c == '{' || c == '[':
+		a.stack = append(a.stack, c)
+		a.stable = a.scanned + 1
+		a.state = scanArrayStart
+		if c == '{' {
+			a.state = scanObjectStart
+		}
+	case c == '"':
+		a.state = scanString
+	case c == '-':
+		a.state = scanNumMinus
+	case c == '0':
+		a.state = scanNumZero
+	case '1' <= c && c <= '9':
+		a.state = scanNumInt
+	case c == 't':
+		a.literal = "rue"
+		a.state = scanLiteral
+	case c == 'f':
+		a.literal = "alse"
+		a.state = scanLiteral
+	case c == 'n':
+		a.literal = "ull"
+		a.state = scanLiteral
+	default:
+		return a.syntaxError(c, "looking for beginning of value")
+	}
+
+	a.scanned++
+	return nil
+}
+
+// close scans c, which closes the innermost object or array.
+func (a *JSONAccumulator) close(c byte) error {
+	open := a.stack[len(a.stack)-1]
+	if open == '{' && c != '}' || open == '[' && c != ']' {
+		return a.syntaxError(c, "after value")
+	}
+	a.stack = a.stack[:len(a.stack)-1]
+	a.scanned++
+	return a.endValue()
+}
+
+// endValue finishes the value that ends at a.scanned, reporting it if it is
+// a top-level value.
+func (a *JSONAccumulator) endValue() error {
+	a.stable = a.scanned
+	if len(a.stack) > 0 {
+		a.state = scanAfterValue
+		return nil
+	}
+
+	a.state = scanValue
+	value := json.RawMessage(a.buf[a.start:a.scanned])
+	a.start = -1
+	return a.onValue(value)
+}
+
+func (a *JSONAccumulator) syntaxError(c byte, context string) error {
+	return fmt.Errorf("invalid character %q %s at offset %d of JSON text", c, context, a.discarded+a.scanned)
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,123 @@
+package evsrc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONAccumulator(t *testing.T) {
+	var values []string
+	a := NewJSONAccumulator(func(v json.RawMessage) error {
+		values = append(values, string(v))
+		return nil
+	})
+
+	deltas := []string{`{"ans`, `wer": "4`, `2"}`, ` [1, `, `2]`, "\n12", "3 ", `tr`, `ue`}
+	var after []int
+	for _, delta := range deltas {
+		err := a.Add(Event{Data: []byte(delta)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		after = append(after, len(values))
+	}
+
+	want := []string{`{"answer": "42"}`, `[1, 2]`, `123`, `true`}
+	if len(values) != len(want) {
+		t.Fatalf("Got values %v, wanted %v", values, want)
+	}
+	for i := range values {
+		if values[i] != want[i] {
+			t.Errorf("Got value %#v, wanted %#v", values[i], want[i])
+		}
+	}
+
+	wantAfter := []int{0, 0, 1, 1, 2, 2, 3, 3, 4}
+	for i := range after {
+		if after[i] != wantAfter[i] {
+			t.Errorf("Got value counts %v after each delta, wanted %v", after, wantAfter)
+			break
+		}
+	}
+
+	if len(a.Buffered()) != 0 {
+		t.Errorf("Got %#v left buffered", string(a.Buffered()))
+	}
+}
+
+func TestJSONAccumulatorInvalid(t *testing.T) {
+	a := NewJSONAccumulator(func(v json.RawMessage) error { return nil })
+	_, err := a.Write([]byte(`{"a": }`))
+	if err == nil {
+		t.Errorf("JSONAccumulator accepted invalid JSON")
+	}
+}
+
+func TestJSONAccumulatorPrefix(t *testing.T) {
+	var got []string
+	a := NewJSONAccumulator(func(v json.RawMessage) error {
+		got = append(got, "value "+string(v))
+		return nil
+	})
+	a.OnPrefix = func(prefix []byte) error {
+		got = append(got, "prefix "+string(prefix))
+		return nil
+	}
+
+	deltas := []string{`{"a": [1, 2`, `0, tr`, `ue], "b": "x`, `y`, `"}`}
+	for _, delta := range deltas {
+		_, err := a.Write([]byte(delta))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		`prefix {"a": [1,`,
+		`prefix {"a": [1, 20,`,
+		`prefix {"a": [1, 20, true], "b":`,
+		`value {"a": [1, 20, true], "b": "xy"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+}
+
+func TestJSONAccumulatorByteAtATime(t *testing.T) {
+	text := `{"s": "a\"b\\cé", "n": [-0.5e+3, 0, 10E2], "x": {}, "y": [], "z": null} false`
+
+	var values []string
+	a := NewJSONAccumulator(func(v json.RawMessage) error {
+		if !json.Valid(v) {
+			t.Errorf("Got invalid value %#v", string(v))
+		}
+		values = append(values, string(v))
+		return nil
+	})
+	for i := 0; i < len(text); i++ {
+		_, err := a.Write([]byte{text[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(values) != 2 || values[0]+" "+values[1] != text {
+		t.Errorf("Got values %q", values)
+	}
+}
+
+func TestJSONAccumulatorInvalidEarly(t *testing.T) {
+	tests := []string{`[1, }`, `{"a" 1`, `{1`, `"\x`, `[01`, `-x`, `1.e`, `nul1`, `[1 2`}
+	for _, text := range tests {
+		a := NewJSONAccumulator(func(v json.RawMessage) error { return nil })
+		_, err := a.Write([]byte(text))
+		if err == nil {
+			t.Errorf("JSONAccumulator accepted the start of %#v", text)
+			continue
+		}
+		if _, err2 := a.Write([]byte("1 ")); err2 != err {
+			t.Errorf("Write after an error returned %v, wanted %v", err2, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package llmstream decodes the event streams used by popular LLM streaming
+// APIs: OpenAI-style streams of JSON chunks terminated by "data: [DONE]", and
+// Anthropic-style streams of named message and content block events.
+package llmstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+// DoneSentinel is the Data of the final Event of an OpenAI-style stream.
+const DoneSentinel = "[DONE]"
+
+// IsDone reports whether e marks the end of a stream, either as an
+// OpenAI-style done sentinel or an Anthropic-style message_stop Event.
+func IsDone(e evsrc.Event) bool {
+	return string(e.Data) == DoneSentinel || e.Event == "message_stop"
+}
+
+// A Delta is the incremental content carried by a single Event.
+type Delta struct {
+	// Text is the generated text in this Event.
+	Text string
+
+	// FinishReason is why generation stopped, if this Event reports it, such
+	// as "stop" or "end_turn".
+	FinishReason string
+}
+
+// An APIError is an error reported in-band by the stream.
+type APIError struct {
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Type == "" {
+		return "llmstream: " + e.Message
+	}
+	return fmt.Sprintf("llmstream: %s: %s", e.Type, e.Message)
+}
+
+type chunkJSON struct {
+	// OpenAI
+	Choices []struct {
+		Text  string `json:"text"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+
+	// Anthropic
+	Type  string `json:"type"`
+	Delta struct {
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+
+	// Both
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ParseDelta extracts the Delta from e. It returns false if e carries no
+// content, such as pings, message start events, and the done sentinel. Errors
+// reported by the stream are returned as *APIError.
+func ParseDelta(e evsrc.Event) (Delta, bool, error) {
+	if IsDone(e) || len(e.Data) == 0 {
+		return Delta{}, false, nil
+	}
+
+	var chunk chunkJSON
+	err := json.Unmarshal(e.Data, &chunk)
+	if err != nil {
+		return Delta{}, false, err
+	}
+
+	if chunk.Error != nil {
+		return Delta{}, false, &APIError{chunk.Error.Type, chunk.Error.Message}
+	}
+
+	switch {
+	case len(chunk.Choices) > 0:
+		var d Delta
+		choice := chunk.Choices[0]
+		d.Text = choice.Delta.Content + choice.Text
+		if choice.FinishReason != nil {
+			d.FinishReason = *choice.FinishReason
+		}
+		return d, true, nil
+
+	case chunk.Type == "content_block_delta":
+		return Delta{Text: chunk.Delta.Text}, true, nil
+
+	case chunk.Type == "message_delta" && chunk.Delta.StopReason != "":
+		return Delta{FinishReason: chunk.Delta.StopReason}, true, nil
+	}
+
+	return Delta{}, false, nil
+}
+
+// A Completion is the result of accumulating a whole stream.
+type Completion struct {
+	Text         string
+	FinishReason string
+}
+
+// An Accumulator builds a Completion from a stream's Events.
+type Accumulator struct {
+	text         strings.Builder
+	finishReason string
+	done         bool
+}
+
+// Add processes e, returning true once the end of the stream has been seen.
+func (a *Accumulator) Add(e evsrc.Event) (done bool, err error) {
+	if IsDone(e) {
+		a.done = true
+		return true, nil
+	}
+
+	d, ok, err := ParseDelta(e)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	a.text.WriteString(d.Text)
+	if d.FinishReason != "" {
+		a.finishReason = d.FinishReason
+	}
+	return false, nil
+}
+
+// Completion returns what has been accumulated so far.
+func (a *Accumulator) Completion() Completion {
+	return Completion{Text: a.text.String(), FinishReason: a.finishReason}
+}
+
+var errNoDone = errors.New("llmstream: stream ended without a done event")
+
+// Collect reads Events from conn until the end of the stream, returning the
+// accumulated Completion. If the connection ends before the stream is done,
+// Collect returns what it has along with an error.
+func Collect(conn *evsrc.ClientConn) (Completion, error) {
+	var a Accumulator
+	var ev evsrc.Event
+	for {
+		var err error
+		ev, err = conn.Receive(ev.Data)
+		if err == io.EOF {
+			return a.Completion(), errNoDone
+		}
+		if err != nil {
+			return a.Completion(), err
+		}
+
+		done, err := a.Add(ev)
+		if err != nil {
+			return a.Completion(), err
+		}
+		if done {
+			return a.Completion(), nil
+		}
+	}
+}
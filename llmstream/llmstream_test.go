@@ -0,0 +1,96 @@
+package llmstream
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/encryptio/go-evsrc"
+)
+
+func collectString(t *testing.T, stream string) (Completion, error) {
+	conn, err := evsrc.NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Collect(conn)
+}
+
+func TestCollectOpenAI(t *testing.T) {
+	stream := `data: {"choices":[{"delta":{"role":"assistant"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{"content":"Hello"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{"content":", world"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`
+	got, err := collectString(t, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Completion{Text: "Hello, world", FinishReason: "stop"}
+	if got != want {
+		t.Errorf("Got %#v, wanted %#v", got, want)
+	}
+}
+
+func TestCollectAnthropic(t *testing.T) {
+	stream := `event: message_start
+data: {"type":"message_start","message":{}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+	got, err := collectString(t, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Completion{Text: "Hi there", FinishReason: "end_turn"}
+	if got != want {
+		t.Errorf("Got %#v, wanted %#v", got, want)
+	}
+}
+
+func TestCollectError(t *testing.T) {
+	stream := `event: content_block_delta
+data: {"type":"content_block_delta","delta":{"text":"partial"}}
+
+event: error
+data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}
+
+`
+	got, err := collectString(t, stream)
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Type != "overloaded_error" {
+		t.Errorf("Got err = %v, wanted an overloaded_error APIError", err)
+	}
+	if got.Text != "partial" {
+		t.Errorf("Got text %#v, wanted \"partial\"", got.Text)
+	}
+}
+
+func TestCollectTruncated(t *testing.T) {
+	_, err := collectString(t, "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n")
+	if err != errNoDone {
+		t.Errorf("Got err = %v, wanted %v", err, errNoDone)
+	}
+}
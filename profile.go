@@ -0,0 +1,52 @@
+package evsrc
+
+// A Profile controls the details of how a ServerConn formats Events that do
+// not affect their meaning to clients, so that its output can match other
+// event stream producers byte for byte (for golden-file tests or clients that
+// are picky about formatting).
+type Profile struct {
+	// FieldOrder is the order in which the "event", "id", "retry", and
+	// "data" fields are written. Fields not listed are written after the
+	// listed ones, in that default order.
+	FieldOrder []string
+
+	// NoSpaceAfterColon omits the space between field names and values, as
+	// in "data:value". A space is still written before values that start
+	// with a space, since clients would otherwise strip it.
+	NoSpaceAfterColon bool
+
+	// Keepalive is the text of the comment sent for keepalives, which is
+	// written after the colon. The default sends a bare ":" line.
+	Keepalive string
+}
+
+var defaultFieldOrder = []string{"event", "id", "retry", "data"}
+
+func (p Profile) fieldOrder() []string {
+	if len(p.FieldOrder) == 0 {
+		return defaultFieldOrder
+	}
+
+	order := make([]string, 0, len(defaultFieldOrder))
+	listed := make(map[string]bool)
+	for _, field := range p.FieldOrder {
+		if !listed[field] {
+			order = append(order, field)
+			listed[field] = true
+		}
+	}
+	for _, field := range defaultFieldOrder {
+		if !listed[field] {
+			order = append(order, field)
+		}
+	}
+	return order
+}
+
+// separator returns what to write between a field's name and value.
+func (p Profile) separator(value []byte) string {
+	if p.NoSpaceAfterColon && (len(value) == 0 || value[0] != ' ') {
+		return ":"
+	}
+	return ": "
+}
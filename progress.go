@@ -0,0 +1,57 @@
+package evsrc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProgressEventName is the Event name used for Progress Events.
+const ProgressEventName = "progress"
+
+// Progress describes how far along an operation is. It is sent as the JSON
+// Data of an Event named ProgressEventName, in the form
+//
+//	{"percent": 42.5, "message": "copying files", "eta": 12.5}
+//
+// where eta is in seconds. Message and eta are omitted when zero.
+type Progress struct {
+	Percent float64
+	Message string
+	ETA     time.Duration
+}
+
+type progressJSON struct {
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+	ETA     float64 `json:"eta,omitempty"`
+}
+
+// SendProgress sends p using send, which is typically ServerConn.Send or the
+// function given to a StreamFunc callback.
+func SendProgress(send func(Event) error, p Progress) error {
+	data, err := json.Marshal(progressJSON{p.Percent, p.Message, p.ETA.Seconds()})
+	if err != nil {
+		return err
+	}
+	return send(Event{Event: ProgressEventName, Data: data})
+}
+
+// ParseProgress decodes a Progress from an Event sent by SendProgress.
+func ParseProgress(e Event) (Progress, error) {
+	if e.Event != ProgressEventName {
+		return Progress{}, fmt.Errorf("event %q is not a %q event", e.Event, ProgressEventName)
+	}
+
+	var pj progressJSON
+	err := json.Unmarshal(e.Data, &pj)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	return Progress{
+		Percent: pj.Percent,
+		Message: pj.Message,
+		ETA:     time.Duration(pj.ETA * float64(time.Second)),
+	}, nil
+}
@@ -0,0 +1,39 @@
+package evsrc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressRoundTrip(t *testing.T) {
+	want := Progress{Percent: 42.5, Message: "copying", ETA: 1500 * time.Millisecond}
+
+	var sent Event
+	err := SendProgress(func(e Event) error {
+		sent = e
+		return nil
+	}, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantData := `{"percent":42.5,"message":"copying","eta":1.5}`
+	if sent.Event != ProgressEventName || string(sent.Data) != wantData {
+		t.Errorf("Got event %#v, wanted name %#v and data %#v", sent, ProgressEventName, wantData)
+	}
+
+	got, err := ParseProgress(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Got %#v, wanted %#v", got, want)
+	}
+}
+
+func TestParseProgressWrongEvent(t *testing.T) {
+	_, err := ParseProgress(Event{Event: "other", Data: []byte(`{"percent":1}`)})
+	if err == nil {
+		t.Errorf("ParseProgress accepted an event with the wrong name")
+	}
+}
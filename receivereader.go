@@ -0,0 +1,268 @@
+package evsrc
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// An EventHeader holds the fields of an Event other than its Data.
+type EventHeader struct {
+	Event       string
+	ID          string
+	Retry       int
+	ContentType string
+}
+
+// ReceiveReader reads the next Event from the connection like Receive, but
+// instead of buffering the Event's Data it returns as soon as the first data
+// line starts, with a Reader that streams the Data as it arrives. The Data
+// read is the same as Receive would return, and is not limited by
+// MaxDataSize.
+//
+// The EventHeader holds the fields sent before the first data line. Fields
+// sent between data lines still update LastEventID, but cannot change the
+// returned EventHeader.
+//
+// The Reader returns io.EOF at the end of the Event. It is only valid until
+// the next call to a Receive method, which discards any unread Data.
+func (c *ClientConn) ReceiveReader() (EventHeader, io.Reader, error) {
+	err := c.start()
+	if err != nil {
+		return EventHeader{}, nil, err
+	}
+
+	r := &eventDataReader{c: c}
+	if c.pending && len(c.event.Data) > 0 {
+		// Continue an Event interrupted in Receive: its buffered Data goes
+		// first, without the newline after its last line.
+		r.prefix = c.event.Data[:len(c.event.Data)-1]
+		r.needNewline = true
+	} else if !c.pending {
+		c.event = Event{}
+		c.sentAt = time.Time{}
+		c.pending = true
+	}
+
+	for len(r.prefix) == 0 && !r.inLine {
+		if c.atDataField() {
+			err := r.startDataLine()
+			if err != nil {
+				return EventHeader{}, nil, err
+			}
+			break
+		}
+
+		line, err := c.readLine()
+		if err != nil {
+			return EventHeader{}, nil, err
+		}
+
+		line, err = c.startLine(line)
+		if err != nil {
+			return EventHeader{}, nil, err
+		}
+		if len(line) == 0 {
+			// No data yet, so there is nothing to dispatch.
+			c.skipEmptyEvent()
+			continue
+		}
+
+		name, value := splitField(line)
+		if string(name) == "data" {
+			r.prefix = append([]byte(nil), value...)
+			r.needNewline = true
+			break
+		}
+
+		err = c.processField(name, value)
+		if err != nil {
+			return EventHeader{}, nil, err
+		}
+	}
+
+	header := EventHeader{Event: c.event.Event, ID: c.event.ID, Retry: c.event.Retry, ContentType: c.event.ContentType}
+	c.event = Event{}
+	c.encoding = ""
+	c.pending = false
+	c.stream = r
+	c.dispatched()
+
+	return header, r, nil
+}
+
+// finishStream discards the rest of the data reader returned by ReceiveReader,
+// if any.
+func (c *ClientConn) finishStream() error {
+	if c.stream == nil {
+		return nil
+	}
+
+	_, err := io.Copy(io.Discard, c.stream)
+	c.stream = nil
+	return err
+}
+
+// atDataField reports whether the next line in the stream starts with
+// "data:", without consuming it.
+func (c *ClientConn) atDataField() bool {
+	if len(c.line) > 0 || c.discardLine || c.discardEvent || c.skipPendingLF() != nil {
+		return false
+	}
+
+	const prefix = "data:"
+	for n := 1; n <= len(prefix); n++ {
+		p, err := c.br.Peek(n)
+		if err != nil || p[n-1] != prefix[n-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// readLinePart reads up to len(p) bytes of the current line into p, stopping
+// at its end, which may be a CR, LF, or CRLF pair. It returns true if the end
+// of the line was reached.
+func (c *ClientConn) readLinePart(p []byte) (int, bool, error) {
+	if c.br.Buffered() == 0 {
+		_, err := c.br.Peek(1)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	n := c.br.Buffered()
+	if n > len(p) {
+		n = len(p)
+	}
+	buf, _ := c.br.Peek(n)
+
+	if i := bytes.IndexAny(buf, "\r\n"); i != -1 {
+		c.skipLF = buf[i] == '\r'
+		copy(p, buf[:i])
+		c.br.Discard(i + 1)
+		c.countRead(i + 1)
+		return i, true, nil
+	}
+
+	copy(p, buf)
+	c.br.Discard(n)
+	c.countRead(n)
+	return n, false, nil
+}
+
+var newline = []byte("\n")
+
+// eventDataReader streams the Data of an Event returned by ReceiveReader.
+type eventDataReader struct {
+	c *ClientConn
+
+	// prefix is data to return before reading more from the stream.
+	prefix []byte
+
+	// needNewline is set after a data line ends, since a newline separates
+	// it from the next data line (if there is one).
+	needNewline bool
+
+	// inLine is set while in the middle of streaming a data line.
+	inLine bool
+
+	err error
+}
+
+func (r *eventDataReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if len(r.prefix) > 0 {
+			n := copy(p, r.prefix)
+			r.prefix = r.prefix[n:]
+			return n, nil
+		}
+
+		if r.inLine {
+			n, eol, err := r.c.readLinePart(p)
+			if err != nil {
+				r.err = unexpectedEOF(err)
+				return n, r.err
+			}
+			if eol {
+				r.inLine = false
+				r.needNewline = true
+			}
+			if n > 0 || len(p) == 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		if r.c.atDataField() {
+			r.err = r.startDataLine()
+			continue
+		}
+
+		line, err := r.c.readLine()
+		if err != nil {
+			r.err = unexpectedEOF(err)
+			break
+		}
+
+		line, err = r.c.startLine(line)
+		if err != nil {
+			r.err = err
+			break
+		}
+		if len(line) == 0 {
+			r.err = io.EOF
+			r.c.stream = nil
+			break
+		}
+
+		name, value := splitField(line)
+		if string(name) == "data" {
+			if r.needNewline {
+				r.prefix = append(r.prefix, '\n')
+			}
+			r.prefix = append(r.prefix, value...)
+			r.needNewline = true
+			continue
+		}
+
+		r.err = r.c.processField(name, value)
+	}
+
+	return 0, r.err
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, since the stream
+// ending in the middle of an Event's Data is not a clean end of the Data.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// startDataLine consumes the "data:" prefix (and a following space) of the
+// next line, so that its value can be streamed.
+func (r *eventDataReader) startDataLine() error {
+	c := r.c
+
+	c.br.Discard(len("data:"))
+	c.countRead(len("data:"))
+	c.lines++
+
+	p, err := c.br.Peek(1)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if p[0] == ' ' {
+		c.br.Discard(1)
+		c.countRead(1)
+	}
+
+	r.inLine = true
+	if r.needNewline {
+		r.prefix = newline
+		r.needNewline = false
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package evsrc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestClientConnReceiveReaderMatchesReceive(t *testing.T) {
+	streams := []string{
+		"data:Hello, world!\n\n",
+		"event:a\nid: 7\ndata:1\ndata:2\n\n",
+		"event:a\ncontent-type: text/html\ndata:<p>\n\n",
+		"data:a\ndata\ndata: b\n\n",
+		"data:\n\n",
+		":\n\nevent:a\n\ndata: after empty\n\n",
+		"data:ends with newline\ndata:\n\n",
+		"\xEF\xBB\xBFdata: bom\n\n",
+		"data: " + strings.Repeat("long line ", 1000) + "\ndata: second\n\n",
+		"event:a\r\ndata:1\r\ndata:2\r\n\r\n",
+		"data:1\rdata:2\r\r",
+		"id:x\r\ndata:1\rdata:2\n\r\n",
+	}
+
+	for _, stream := range streams {
+		client, err := NewClientConn(bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(stream)), 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, r, err := client.ReceiveReader()
+		if err != nil {
+			t.Errorf("ReceiveReader on %#v: %v", stream, err)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("Reading data of %#v: %v", stream, err)
+			continue
+		}
+
+		client, err = NewClientConn(bufio.NewReader(strings.NewReader(stream)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := client.Receive(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, want.Data) {
+			t.Errorf("Got data %#v from %#v, but Receive returned %#v", string(data), stream, string(want.Data))
+		}
+		wantHeader := EventHeader{Event: want.Event, ID: want.ID, Retry: want.Retry, ContentType: want.ContentType}
+		if header != wantHeader {
+			t.Errorf("Got header %#v from %#v, wanted %#v", header, stream, wantHeader)
+		}
+	}
+}
+
+func TestClientConnReceiveReaderDiscardsUnread(t *testing.T) {
+	client, err := NewClientConn(bufio.NewReader(strings.NewReader(
+		"data: first\ndata: more\n\nid: 2\ndata: second\n\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, r, err := client.ReceiveReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	_, err = r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Event{ID: "2", Data: []byte("second")}
+	if !ev.Eq(want) {
+		t.Errorf("Got event %#v, wanted %#v", ev, want)
+	}
+}
+
+func TestClientConnReceiveReaderTruncated(t *testing.T) {
+	client, err := NewClientConn(bufio.NewReader(strings.NewReader("data: cut off\ndata: here")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, r, err := client.ReceiveReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(r)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Got err = %v, wanted %v", err, io.ErrUnexpectedEOF)
+	}
+}
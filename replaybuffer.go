@@ -0,0 +1,229 @@
+package evsrc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+)
+
+// A ReplayBuffer keeps recently published Events, so that a client resuming a
+// stream with a Last-Event-ID can be sent the Events it missed before it is
+// sent live ones.
+//
+// ReplayBuffers are safe for concurrent use.
+type ReplayBuffer struct {
+	// Clock is used to expire Events. If nil, the system clock is used. It
+	// must be set before the first call to Add.
+	Clock Clock
+
+	// Compressor, if non-nil, is used to compress the Data of stored Events,
+	// and to decompress it when they are replayed, so that more Events can be
+	// kept in the same memory. It must be set before the first call to Add.
+	Compressor Compressor
+
+	capacity int
+	ttl      time.Duration
+
+	// entries is a ring of capacity entries, of which count starting at head
+	// are in use, oldest first.
+	mu       sync.Mutex
+	entries  []replayEntry
+	head     int
+	count    int
+	firstSeq uint64            // sequence number of the oldest entry
+	ids      map[string]uint64 // ID to sequence number of its newest Event
+}
+
+type replayEntry struct {
+	at         time.Time
+	event      Event
+	compressed bool
+}
+
+// A Compressor compresses data for storage. Implementations for formats such
+// as snappy or zstd can wrap third-party packages; GzipCompressor is provided.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor is a Compressor using compress/gzip.
+var GzipCompressor Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+// NewReplayBuffer returns a ReplayBuffer holding at most capacity Events, none
+// older than ttl. A zero ttl keeps Events until they are pushed out by newer
+// ones.
+func NewReplayBuffer(capacity int, ttl time.Duration) *ReplayBuffer {
+	return &ReplayBuffer{
+		capacity: capacity,
+		ttl:      ttl,
+		ids:      make(map[string]uint64),
+	}
+}
+
+// empty returns a new, empty ReplayBuffer configured like b.
+func (b *ReplayBuffer) empty() *ReplayBuffer {
+	e := NewReplayBuffer(b.capacity, b.ttl)
+	e.Compressor = b.Compressor
+	e.Clock = b.Clock
+	return e
+}
+
+// Add records a copy of e as the newest Event.
+func (b *ReplayBuffer) Add(e Event) {
+	b.insert(b.prepare(e))
+}
+
+// prepare copies and compresses e for insert. It is separate from insert so
+// that callers can do the expensive part without holding their own locks.
+func (b *ReplayBuffer) prepare(e Event) replayEntry {
+	entry := replayEntry{at: clockOrSystem(b.Clock).Now(), event: e.Clone()}
+	if b.Compressor != nil && len(e.Data) > 0 {
+		compressed, err := b.Compressor.Compress(e.Data)
+		if err == nil {
+			entry.event.Data = compressed
+			entry.compressed = true
+		}
+	}
+	return entry
+}
+
+func (b *ReplayBuffer) insert(entry replayEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.capacity <= 0 {
+		return
+	}
+	if b.entries == nil {
+		b.entries = make([]replayEntry, b.capacity)
+	}
+
+	if b.count == b.capacity {
+		b.drop(1)
+	}
+
+	seq := b.firstSeq + uint64(b.count)
+	b.entries[(b.head+b.count)%b.capacity] = entry
+	b.count++
+	if id := entry.event.ID; id != "" {
+		b.ids[id] = seq
+	}
+
+	b.expire(entry.at)
+}
+
+// entry returns the entry with sequence number seq, which must be in the
+// buffer.
+func (b *ReplayBuffer) entry(seq uint64) *replayEntry {
+	return &b.entries[(b.head+int(seq-b.firstSeq))%b.capacity]
+}
+
+// drop removes the oldest n entries.
+func (b *ReplayBuffer) drop(n int) {
+	for i := 0; i < n; i++ {
+		entry := &b.entries[b.head]
+		if id := entry.event.ID; id != "" && b.ids[id] == b.firstSeq {
+			delete(b.ids, id)
+		}
+
+		*entry = replayEntry{}
+		b.head = (b.head + 1) % b.capacity
+		b.count--
+		b.firstSeq++
+	}
+}
+
+func (b *ReplayBuffer) expire(now time.Time) {
+	if b.ttl <= 0 {
+		return
+	}
+
+	cutoff := now.Add(-b.ttl)
+	n := 0
+	for n < b.count && b.entry(b.firstSeq+uint64(n)).at.Before(cutoff) {
+		n++
+	}
+	if n > 0 {
+		b.drop(n)
+	}
+}
+
+// Since returns the Events added after the newest one with ID lastEventID,
+// oldest first, and true. If no Event with that ID is in the buffer, because
+// it has been pushed out or expired or was never added, Since returns false:
+// the client has missed an unknown number of Events. Since also returns false
+// if an Event's Data can't be decompressed. The caller must not modify the
+// returned Events' Data.
+func (b *ReplayBuffer) Since(lastEventID string) ([]Event, bool) {
+	entries, ok := b.since(lastEventID)
+	if !ok {
+		return nil, false
+	}
+	return b.decompress(entries)
+}
+
+// since returns the entries Since would return the Events of, without
+// decompressing them, so that callers can decompress without holding their
+// own locks.
+func (b *ReplayBuffer) since(lastEventID string) ([]replayEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count > 0 {
+		b.expire(clockOrSystem(b.Clock).Now())
+	}
+
+	seq, ok := b.ids[lastEventID]
+	if !ok {
+		return nil, false
+	}
+
+	var entries []replayEntry
+	for seq++; seq < b.firstSeq+uint64(b.count); seq++ {
+		entries = append(entries, *b.entry(seq))
+	}
+	return entries, true
+}
+
+func (b *ReplayBuffer) decompress(entries []replayEntry) ([]Event, bool) {
+	var events []Event
+	for _, entry := range entries {
+		e := entry.event
+		if entry.compressed {
+			data, err := b.Compressor.Decompress(e.Data)
+			if err != nil {
+				return nil, false
+			}
+			e.Data = data
+		}
+		events = append(events, e)
+	}
+	return events, true
+}
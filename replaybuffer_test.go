@@ -0,0 +1,126 @@
+package evsrc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func replayIDs(b *ReplayBuffer, lastEventID string) string {
+	events, ok := b.Since(lastEventID)
+	if !ok {
+		return "unknown"
+	}
+	return strings.Join(timelineIDs(events), ",")
+}
+
+func TestReplayBufferCapacity(t *testing.T) {
+	b := NewReplayBuffer(3, 0)
+	for _, id := range []string{"1", "2", "", "3", "4"} {
+		b.Add(Event{ID: id, Data: []byte("x")})
+	}
+
+	tests := []struct {
+		lastEventID string
+		want        string
+	}{
+		{"4", ""},
+		{"3", "4"},
+		{"2", "unknown"}, // pushed out
+		{"1", "unknown"},
+		{"5", "unknown"},
+		{"", "unknown"},
+	}
+	for _, test := range tests {
+		if got := replayIDs(b, test.lastEventID); got != test.want {
+			t.Errorf("Since(%q) = %v, wanted %v", test.lastEventID, got, test.want)
+		}
+	}
+
+	// A repeated ID resumes after its newest use.
+	b.Add(Event{ID: "3", Data: []byte("x")})
+	b.Add(Event{ID: "5", Data: []byte("x")})
+	if got := replayIDs(b, "3"); got != "5" {
+		t.Errorf("Since(3) = %v after ID 3 was reused, wanted 5", got)
+	}
+}
+
+func TestReplayBufferWraparound(t *testing.T) {
+	b := NewReplayBuffer(3, 0)
+	for i := 1; i <= 10; i++ {
+		b.Add(Event{ID: strconv.Itoa(i), Data: []byte("x")})
+		if i < 4 {
+			continue
+		}
+
+		// The oldest of the three entries held is the one before i-1.
+		want := strconv.Itoa(i-1) + "," + strconv.Itoa(i)
+		if got := replayIDs(b, strconv.Itoa(i-2)); got != want {
+			t.Errorf("After adding %v, Since(%v) = %v, wanted %v", i, i-2, got, want)
+		}
+		if got := replayIDs(b, strconv.Itoa(i-3)); got != "unknown" {
+			t.Errorf("After adding %v, Since(%v) = %v, wanted unknown", i, i-3, got)
+		}
+	}
+}
+
+func TestReplayBufferTTL(t *testing.T) {
+	clock := &steppingClock{now: time.Unix(1000, 0)}
+	b := NewReplayBuffer(100, time.Minute)
+	b.Clock = clock
+
+	for _, id := range []string{"1", "2", "3"} {
+		b.Add(Event{ID: id, Data: []byte("x")})
+		clock.now = clock.now.Add(25 * time.Second)
+	}
+
+	// Now 75 seconds after the first Event, so it has expired.
+	if got := replayIDs(b, "1"); got != "unknown" {
+		t.Errorf("Since(1) = %v, wanted it expired", got)
+	}
+	if got := replayIDs(b, "2"); got != "3" {
+		t.Errorf("Since(2) = %v, wanted 3", got)
+	}
+}
+
+type brokenCompressor struct{}
+
+func (brokenCompressor) Compress(data []byte) ([]byte, error) { return data, nil }
+func (brokenCompressor) Decompress(data []byte) ([]byte, error) {
+	return nil, errors.New("corrupt")
+}
+
+func TestReplayBufferCompression(t *testing.T) {
+	b := NewReplayBuffer(10, 0)
+	b.Compressor = GzipCompressor
+
+	big := Event{ID: "2", Data: []byte(strings.Repeat("compressible ", 1000))}
+	b.Add(Event{ID: "1", Data: []byte("x")})
+	b.Add(big)
+	b.Add(Event{ID: "3", Data: []byte{}})
+
+	if stored := len(b.entry(1).event.Data); stored >= len(big.Data)/10 {
+		t.Errorf("Stored %v bytes of Data for %v bytes of text", stored, len(big.Data))
+	}
+
+	events, ok := b.Since("1")
+	if !ok || len(events) != 2 {
+		t.Fatalf("Since(1) = %v, %v", len(events), ok)
+	}
+	if !events[0].Eq(big) {
+		t.Errorf("Replayed Data differs from the original")
+	}
+	if events[1].Data == nil || len(events[1].Data) != 0 {
+		t.Errorf("Got Data %#v for an empty Event, wanted empty and non-nil", events[1].Data)
+	}
+
+	b = NewReplayBuffer(10, 0)
+	b.Compressor = brokenCompressor{}
+	b.Add(Event{ID: "1", Data: []byte("x")})
+	b.Add(Event{ID: "2", Data: []byte("x")})
+	if _, ok := b.Since("1"); ok {
+		t.Errorf("Since succeeded with Data that can't be decompressed")
+	}
+}
@@ -0,0 +1,80 @@
+package evsrc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// ErrInvalidResumeToken is returned by ResumeTokens.Open for tokens that were
+// not sealed with the same key, or that were modified.
+var ErrInvalidResumeToken = errors.New("invalid resume token")
+
+// resumeTokenContext is authenticated along with every token, so that other
+// values sealed with the same key can't be passed off as resume tokens.
+var resumeTokenContext = []byte("evsrc resume token")
+
+// ResumeTokens seals server-internal resume positions into opaque Event IDs,
+// and opens them again when a client reconnects with one as its Last-Event-ID.
+// Tokens are encrypted and authenticated with AES-GCM, so clients can neither
+// read nor forge positions, and so can't come to depend on their format.
+//
+// ResumeTokens are safe for concurrent use.
+type ResumeTokens struct {
+	aead cipher.AEAD
+}
+
+// NewResumeTokens returns a ResumeTokens using key, which must be 16, 24, or
+// 32 bytes long to select AES-128, AES-192, or AES-256. Every server that may
+// receive a client's reconnection must use the same key.
+func NewResumeTokens(key []byte) (*ResumeTokens, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResumeTokens{aead: aead}, nil
+}
+
+// Seal returns an opaque token for position, suitable for use as an Event ID.
+// Sealing the same position twice gives different tokens.
+func (t *ResumeTokens) Seal(position string) string {
+	nonce := make([]byte, t.aead.NonceSize(), t.aead.NonceSize()+len(position)+t.aead.Overhead())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		panic("evsrc: can't read random nonce: " + err.Error())
+	}
+
+	sealed := t.aead.Seal(nonce, nonce, []byte(position), resumeTokenContext)
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// Open returns the position sealed in token, or ErrInvalidResumeToken if token
+// was not returned by Seal with the same key.
+func (t *ResumeTokens) Open(token string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(sealed) < t.aead.NonceSize() {
+		return "", ErrInvalidResumeToken
+	}
+
+	nonce, ciphertext := sealed[:t.aead.NonceSize()], sealed[t.aead.NonceSize():]
+	position, err := t.aead.Open(nil, nonce, ciphertext, resumeTokenContext)
+	if err != nil {
+		return "", ErrInvalidResumeToken
+	}
+	return string(position), nil
+}
+
+// Transform returns a Transform that replaces the ID of every Event with an ID
+// with a token sealing it.
+func (t *ResumeTokens) Transform() Transform {
+	return RewriteID(t.Seal)
+}
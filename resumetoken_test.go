@@ -0,0 +1,50 @@
+package evsrc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResumeTokens(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	tokens, err := NewResumeTokens(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, ok := tokens.Transform()(Event{ID: "partition-3/offset-1234", Data: []byte("x")})
+	if !ok {
+		t.Fatalf("Transform dropped the Event")
+	}
+	if bytes.Contains([]byte(ev.ID), []byte("1234")) {
+		t.Errorf("token %q reveals the position", ev.ID)
+	}
+
+	position, err := tokens.Open(ev.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != "partition-3/offset-1234" {
+		t.Errorf("Open returned %q, wanted the sealed position", position)
+	}
+
+	if tokens.Seal("1") == tokens.Seal("1") {
+		t.Errorf("Seal gave the same token twice")
+	}
+
+	otherKey, _ := NewResumeTokens(bytes.Repeat([]byte("o"), 32))
+	forged := []byte(ev.ID)
+	forged[len(forged)/2] ^= 1
+
+	for _, bad := range []string{"", "1234", "!!!", string(forged), otherKey.Seal("1")} {
+		_, err := tokens.Open(bad)
+		if err != ErrInvalidResumeToken {
+			t.Errorf("Open(%q) returned error %v, wanted %v", bad, err, ErrInvalidResumeToken)
+		}
+	}
+
+	_, err = NewResumeTokens([]byte("short"))
+	if err == nil {
+		t.Errorf("NewResumeTokens accepted a 5 byte key")
+	}
+}
@@ -0,0 +1,80 @@
+package evsrc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SchemaEventName is the name of the Event announcing the payload schema
+// versions a stream can be read with. By convention it is the first Event of
+// the stream.
+const SchemaEventName = "_schema"
+
+// A SchemaMismatchError is returned by NegotiateSchema when the stream and
+// the client have no schema version in common. Clients should report it
+// rather than guessing at payloads they may misread.
+type SchemaMismatchError struct {
+	Offered   []string
+	Supported []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("stream offers schema versions [%s], but only [%s] are supported",
+		strings.Join(e.Offered, ", "), strings.Join(e.Supported, ", "))
+}
+
+type schemaJSON struct {
+	Versions []string `json:"versions"`
+}
+
+// SendSchema sends an Event named SchemaEventName announcing versions, in the
+// form
+//
+//	{"versions": ["v3", "v2"]}
+//
+// Producers should list the newest version first, followed by the older
+// versions whose consumers can still read the stream, and send it before any
+// other Event.
+func SendSchema(send func(Event) error, versions ...string) error {
+	data, err := json.Marshal(schemaJSON{versions})
+	if err != nil {
+		return err
+	}
+	return send(Event{Event: SchemaEventName, Data: data})
+}
+
+// ParseSchema decodes the versions from an Event sent by SendSchema.
+func ParseSchema(e Event) ([]string, error) {
+	if e.Event != SchemaEventName {
+		return nil, fmt.Errorf("event %q is not a %q event", e.Event, SchemaEventName)
+	}
+
+	var sj schemaJSON
+	err := json.Unmarshal(e.Data, &sj)
+	if err != nil {
+		return nil, err
+	}
+	return sj.Versions, nil
+}
+
+// NegotiateSchema picks the version to read a stream with, given its schema
+// Event and the versions the client supports. It returns the first version
+// offered by the stream that is also in supported, or a *SchemaMismatchError
+// if there is none.
+func NegotiateSchema(e Event, supported ...string) (string, error) {
+	offered, err := ParseSchema(e)
+	if err != nil {
+		return "", err
+	}
+
+	for _, o := range offered {
+		for _, s := range supported {
+			if o == s {
+				return o, nil
+			}
+		}
+	}
+
+	return "", &SchemaMismatchError{Offered: offered, Supported: supported}
+}
@@ -0,0 +1,47 @@
+package evsrc
+
+import (
+	"testing"
+)
+
+func TestSchemaNegotiation(t *testing.T) {
+	var sent Event
+	err := SendSchema(func(e Event) error {
+		sent = e
+		return nil
+	}, "v3", "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantData := `{"versions":["v3","v2"]}`
+	if sent.Event != SchemaEventName || string(sent.Data) != wantData {
+		t.Errorf("Got event %#v, wanted name %#v and data %#v", sent, SchemaEventName, wantData)
+	}
+
+	tests := []struct {
+		supported []string
+		want      string
+		mismatch  bool
+	}{
+		{[]string{"v1", "v2", "v3"}, "v3", false},
+		{[]string{"v1", "v2"}, "v2", false},
+		{[]string{"v1"}, "", true},
+		{nil, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := NegotiateSchema(sent, test.supported...)
+		if _, ok := err.(*SchemaMismatchError); ok != test.mismatch {
+			t.Errorf("NegotiateSchema with %v returned error %v, wanted mismatch %v", test.supported, err, test.mismatch)
+		}
+		if got != test.want {
+			t.Errorf("NegotiateSchema with %v = %#v, wanted %#v", test.supported, got, test.want)
+		}
+	}
+
+	_, err = NegotiateSchema(Event{Event: "message", Data: []byte("{}")}, "v1")
+	if err == nil {
+		t.Errorf("NegotiateSchema accepted an Event that isn't a schema Event")
+	}
+}
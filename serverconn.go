@@ -1,17 +1,77 @@
 package evsrc
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// ErrLineBreakInField is returned when sending an Event whose name, ID, or
+// ContentType, or a Profile's keepalive text, contains a carriage return or
+// line feed, which would end the field early and corrupt the stream.
+var ErrLineBreakInField = errors.New("line break in event field")
+
 // A ServerConn contains a http.ResponseWriter, and allows you to Send Events
 // across that http response.
 //
-// ServerConns are not safe for concurrent use.
+// The methods of a ServerConn are safe for concurrent use, but its fields must
+// not be changed once it is in use.
 type ServerConn struct {
-	w http.ResponseWriter
+	// StampSendTime makes Send add a field holding the time the Event was
+	// sent, in milliseconds since the Unix epoch. ClientConns use it to report
+	// delivery latency in their Stats; other clients ignore it.
+	StampSendTime bool
+
+	// Profile controls details of how Events are written, for compatibility
+	// with other producers' output. The zero Profile matches the output of
+	// earlier versions of this package.
+	Profile Profile
+
+	// Clock is used to timestamp activity in Stats. If nil, the system clock
+	// is used.
+	Clock Clock
+
+	// CompressAbove, if positive, makes Send gzip compress the Data of Events
+	// larger than CompressAbove bytes, marking them with an extension field.
+	// Only ClientConns with DecodeData set can read such Events, so it should
+	// only be used with clients known to set it.
+	CompressAbove int
+
+	// OmitContentType makes Send leave out the content-type extension field
+	// that otherwise carries Events' ContentType, including the one set by
+	// SendJSON and the other typed Send helpers, for clients that must only
+	// see the standard fields.
+	OmitContentType bool
+
+	// FlushPolicy controls how often sends flush the output to the client.
+	// The zero FlushPolicy flushes after every send.
+	FlushPolicy FlushPolicy
+
+	// w is the http.ResponseWriter, or for an Encoder, any io.Writer.
+	w io.Writer
+
+	// rc controls w when it is an http.ResponseWriter, finding the
+	// capabilities of ResponseWriters it wraps.
+	rc *http.ResponseController
+
+	// mu serializes writes to w, which the goroutine started by KeepAlive
+	// makes concurrently with the caller's.
+	mu    sync.Mutex
+	stats Stats
+
+	unflushed int
+	lastFlush time.Time
+
+	// stopKeepalive is closed to stop the goroutine started by KeepAlive.
+	stopKeepalive chan struct{}
 }
 
 // NewServerConn takes over the given ResponseWriter (which must not have
@@ -20,10 +80,28 @@ type ServerConn struct {
 //
 // Returning from the http.Handler calling this to the http.Server will cause
 // the ServerConn to be invalidated.
+//
+// Streaming needs w to be able to flush, either itself or through a
+// ResponseWriter it wraps and returns from an Unwrap method, as with
+// http.ResponseController. If it can't, NewServerConn returns a
+// *CapabilityError without writing anything, so that the caller can respond
+// with an error instead of a stream that never arrives.
 func NewServerConn(w http.ResponseWriter) (*ServerConn, error) {
+	err := requireCapability(w, "Flush", canFlush)
+	if err != nil {
+		return nil, err
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.WriteHeader(http.StatusOK)
-	return &ServerConn{w}, nil
+	return &ServerConn{w: w, rc: http.NewResponseController(w)}, nil
+}
+
+// Stats returns the counters for the stream written so far.
+func (s *ServerConn) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
 }
 
 // Send writes an Event to the event stream.
@@ -32,74 +110,460 @@ func NewServerConn(w http.ResponseWriter) (*ServerConn, error) {
 // keepalive message. To send a real empty event (and not just a keepalive),
 // send an Event with its Data field set to non-nil, but zero length. For
 // example, Event{Data: []byte{}}.
+//
+// Clients treat "\r\n", "\r", and "\n" alike as line breaks, and join the
+// lines of Data with "\n", so Data is split on all three and is received with
+// "\n" in place of each. The Event's other fields must not contain line breaks
+// at all; Send returns ErrLineBreakInField if they do.
 func (s *ServerConn) Send(e Event) error {
-	defer s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.send(e)
+}
+
+func (s *ServerConn) send(e Event) error {
+	defer s.sent()
+
+	if t, ok := s.w.(sendTracker); ok {
+		t.beginSend()
+		defer t.endSend()
+	}
 
 	if e.isZero() {
-		_, err := fmt.Fprintf(s.w, ":\n\n")
+		err := checkFields(s.Profile.Keepalive)
+		if err != nil {
+			return err
+		}
+		s.stats.Comments++
+		return s.printf(":%s\n\n", s.Profile.Keepalive)
+	}
+
+	err := checkFields(e.Event, e.ID, e.ContentType)
+	if err != nil {
 		return err
 	}
 
-	if e.Event != "" {
-		_, err := fmt.Fprintf(s.w, "event: %s\n", e.Event)
+	s.stats.Events++
+
+	for _, field := range s.Profile.fieldOrder() {
+		var err error
+		switch field {
+		case "event":
+			if e.Event != "" {
+				err = s.field("event", []byte(e.Event))
+			}
+		case "id":
+			if e.ID != "" {
+				err = s.field("id", []byte(e.ID))
+			}
+		case "retry":
+			if e.Retry != 0 {
+				err = s.field("retry", []byte(strconv.Itoa(e.Retry)))
+			}
+		case "data":
+			err = s.sendData(e.ContentType, e.Data)
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	if e.ID != "" {
-		_, err := fmt.Fprintf(s.w, "id: %s\n", e.ID)
+	return s.printf("\n")
+}
+
+func (s *ServerConn) sendData(contentType string, data []byte) error {
+	if contentType != "" && !s.OmitContentType {
+		err := s.field(contentTypeField, []byte(contentType))
 		if err != nil {
 			return err
 		}
 	}
 
-	if e.Retry != 0 {
-		_, err := fmt.Fprintf(s.w, "retry: %d\n", e.Retry)
+	if s.CompressAbove > 0 && len(data) > s.CompressAbove {
+		encoded, err := encodeData(data)
+		if err != nil {
+			return err
+		}
+		data = encoded
+
+		err = s.field(encodingField, []byte(gzipBase64Encoding))
 		if err != nil {
 			return err
 		}
 	}
 
-	data := e.Data
+	if s.StampSendTime {
+		sentAt := clockOrSystem(s.Clock).Now().UnixNano() / int64(time.Millisecond)
+		err := s.field(sentAtField, []byte(strconv.FormatInt(sentAt, 10)))
+		if err != nil {
+			return err
+		}
+	}
 
-	endsInNewline := false
-	if len(data) > 0 && data[len(data)-1] == '\n' {
-		endsInNewline = true
-		data = data[:len(data)-1]
+	if data == nil {
+		return nil
 	}
 
-	for len(data) > 0 {
-		var thisLine []byte
+	for {
+		line, rest, found := cutLine(data)
+		if !found && len(line) == 0 {
+			// Non-nil empty Data, and Data ending in a line break, still
+			// need a final data line, or clients will drop the line break
+			// or not dispatch the Event at all.
+			return s.printf("data:\n")
+		}
 
-		nextNewline := bytes.IndexByte(data, '\n')
-		if nextNewline == -1 {
-			thisLine = data
-			data = nil
-		} else {
-			thisLine = data[:nextNewline]
-			data = data[nextNewline+1:]
+		err := s.field("data", line)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
 		}
+		data = rest
+	}
+}
+
+// cutLine splits data around its first line break, which is "\r\n", "\r", or
+// "\n", as clients recognize them.
+func cutLine(data []byte) (line, rest []byte, found bool) {
+	i := bytes.IndexAny(data, "\r\n")
+	if i < 0 {
+		return data, nil, false
+	}
+	rest = data[i+1:]
+	if data[i] == '\r' && len(rest) > 0 && rest[0] == '\n' {
+		rest = rest[1:]
+	}
+	return data[:i], rest, true
+}
+
+// checkFields returns ErrLineBreakInField if any of values contains a line
+// break.
+func checkFields(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return ErrLineBreakInField
+		}
+	}
+	return nil
+}
+
+// field writes a single field line, separating the name and value as the
+// Profile asks.
+func (s *ServerConn) field(name string, value []byte) error {
+	return s.printf("%s%s%s\n", name, s.Profile.separator(value), value)
+}
+
+// SendFrom writes an Event named name with the given id (either may be empty)
+// whose Data is read from r, without holding more than a small buffer of it
+// in memory. The Data is split into lines exactly as Send would split it, and
+// name and id must not contain line breaks.
+//
+// If reading from r fails, the Event is left unfinished and the stream is
+// unusable; SendFrom returns the error and the caller should end the
+// response.
+func (s *ServerConn) SendFrom(name, id string, r io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.sent()
 
-		_, err := fmt.Fprintf(s.w, "data: %s\n", thisLine)
+	err := checkFields(name, id)
+	if err != nil {
+		return err
+	}
+
+	if t, ok := s.w.(sendTracker); ok {
+		t.beginSend()
+		defer t.endSend()
+	}
+
+	s.stats.Events++
+
+	if name != "" {
+		err := s.field("event", []byte(name))
 		if err != nil {
 			return err
 		}
 	}
 
-	if endsInNewline {
-		_, err := fmt.Fprintf(s.w, "data:\n")
+	if id != "" {
+		err := s.field("id", []byte(id))
 		if err != nil {
 			return err
 		}
 	}
 
-	_, err := fmt.Fprintf(s.w, "\n")
+	br := bufio.NewReader(r)
+	atLineStart := true
+
+	// skipLF is set after a line ended with a carriage return, so that a line
+	// feed following it in the next chunk completes the same line break.
+	skipLF := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		for len(chunk) > 0 {
+			if skipLF {
+				skipLF = false
+				if chunk[0] == '\n' {
+					chunk = chunk[1:]
+					continue
+				}
+			}
+
+			line, rest, found := cutLine(chunk)
+			if atLineStart {
+				werr := s.printf("data%s", s.Profile.separator(line))
+				if werr != nil {
+					return werr
+				}
+				atLineStart = false
+			}
+			werr := s.write(line)
+			if werr != nil {
+				return werr
+			}
+			if !found {
+				break
+			}
+
+			werr = s.printf("\n")
+			if werr != nil {
+				return werr
+			}
+			atLineStart = true
+			skipLF = len(line) == len(chunk)-1 && chunk[len(line)] == '\r'
+			chunk = rest
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+
+	if atLineStart {
+		// Either the Data was empty or it ended in a newline; both need an
+		// empty data line to be received correctly.
+		err := s.printf("data:\n")
+		if err != nil {
+			return err
+		}
+	} else {
+		err := s.printf("\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.printf("\n")
+}
+
+func (s *ServerConn) write(p []byte) error {
+	n, err := s.w.Write(p)
+	if n > 0 {
+		s.stats.Bytes += int64(n)
+		s.stats.LastActivity = clockOrSystem(s.Clock).Now()
+	}
 	return err
 }
 
+func (s *ServerConn) printf(format string, args ...interface{}) error {
+	n, err := fmt.Fprintf(s.w, format, args...)
+	if n > 0 {
+		s.stats.Bytes += int64(n)
+		s.stats.LastActivity = clockOrSystem(s.Clock).Now()
+	}
+	return err
+}
+
+// SendDone sends an Event named DoneEventName with empty Data, marking the
+// clean end of a finite stream. Clients should stop reconnecting once they
+// receive it.
+func (s *ServerConn) SendDone() error {
+	return s.Send(Event{Event: DoneEventName, Data: []byte{}})
+}
+
+// SendComment writes text to the event stream as a comment, which clients
+// ignore. Text containing line breaks is split into one comment line per line
+// of text. Like keepalives, comments are followed by a blank line.
+func (s *ServerConn) SendComment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.sent()
+
+	if t, ok := s.w.(sendTracker); ok {
+		t.beginSend()
+		defer t.endSend()
+	}
+
+	s.stats.Comments++
+
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+	for _, line := range strings.Split(text, "\n") {
+		var err error
+		if line == "" {
+			err = s.printf(":\n")
+		} else {
+			err = s.printf(": %s\n", line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.printf("\n")
+}
+
+// sent is called after every send, and flushes if the FlushPolicy says to.
+func (s *ServerConn) sent() {
+	s.unflushed++
+	if s.FlushPolicy.due(s.unflushed, s.lastFlush, clockOrSystem(s.Clock).Now()) {
+		s.flush()
+	}
+}
+
+// Flush sends any buffered output to the client. It is only needed when the
+// FlushPolicy leaves output buffered.
+func (s *ServerConn) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
 func (s *ServerConn) flush() {
-	if f, ok := s.w.(http.Flusher); ok {
+	s.unflushed = 0
+	s.lastFlush = clockOrSystem(s.Clock).Now()
+
+	if s.rc != nil {
+		s.rc.Flush()
+	} else if f, ok := s.w.(http.Flusher); ok {
 		f.Flush()
 	}
 }
+
+// SetWriteDeadline sets the deadline for writes to the stream, after which
+// blocked and later sends fail. A zero time means no deadline. It may be
+// called while another goroutine is sending, to give up on a client that
+// has stopped reading.
+//
+// The deadline is set on the first ResponseWriter in the chain given to
+// NewServerConn that supports it, as with http.ResponseController. If none
+// does, SetWriteDeadline returns a *CapabilityError.
+func (s *ServerConn) SetWriteDeadline(t time.Time) error {
+	if s.rc != nil {
+		err := requireCapability(s.w.(http.ResponseWriter), "SetWriteDeadline", canSetWriteDeadline)
+		if err != nil {
+			return err
+		}
+		return s.rc.SetWriteDeadline(t)
+	}
+
+	d, ok := s.w.(interface{ SetWriteDeadline(time.Time) error })
+	if !ok {
+		return &CapabilityError{Capability: "SetWriteDeadline", Chain: []string{fmt.Sprintf("%T", s.w)}}
+	}
+	return d.SetWriteDeadline(t)
+}
+
+// SendEncoded sends an Event named eventName whose Data is v encoded with c.
+func (s *ServerConn) SendEncoded(c Codec, eventName string, v interface{}) error {
+	e, err := EncodeEvent(c, eventName, v)
+	if err != nil {
+		return err
+	}
+	return s.Send(e)
+}
+
+// SendJSON sends an Event named eventName whose Data is v encoded as JSON. It
+// is shorthand for SendEncoded(JSONCodec, eventName, v).
+func (s *ServerConn) SendJSON(eventName string, v interface{}) error {
+	return s.SendEncoded(JSONCodec, eventName, v)
+}
+
+// SendText sends an Event named eventName whose Data is text, with a
+// ContentType of TextContentType.
+func (s *ServerConn) SendText(eventName, text string) error {
+	return s.Send(Event{Event: eventName, Data: []byte(text), ContentType: TextContentType})
+}
+
+// SendHTML sends an Event named eventName whose Data is the HTML fragment
+// html, with a ContentType of HTMLContentType.
+func (s *ServerConn) SendHTML(eventName, html string) error {
+	return s.Send(Event{Event: eventName, Data: []byte(html), ContentType: HTMLContentType})
+}
+
+// SendBase64 sends an Event named eventName whose Data is the standard base64
+// encoding of data, with a ContentType of Base64ContentType. Event.Bytes
+// decodes it.
+func (s *ServerConn) SendBase64(eventName string, data []byte) error {
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+	return s.Send(Event{Event: eventName, Data: encoded, ContentType: Base64ContentType})
+}
+
+// KeepAlive starts a goroutine that sends a keepalive whenever nothing has
+// been written to the stream for interval, so that clients and proxies don't
+// time out idle streams. Keepalives are always flushed, whatever the
+// FlushPolicy. Calling KeepAlive again replaces the previous interval.
+//
+// Close must be called to stop the keepalives before the handler that created
+// the ServerConn returns.
+func (s *ServerConn) KeepAlive(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopKeepalive != nil {
+		close(s.stopKeepalive)
+	}
+	stop := make(chan struct{})
+	s.stopKeepalive = stop
+
+	go s.keepalive(interval, stop)
+}
+
+func (s *ServerConn) keepalive(interval time.Duration, stop chan struct{}) {
+	clock := clockOrSystem(s.Clock)
+
+	wait := interval
+	for {
+		select {
+		case <-clock.After(wait):
+		case <-stop:
+			return
+		}
+
+		s.mu.Lock()
+		select {
+		case <-stop:
+			// Close was called while waiting for the lock.
+			s.mu.Unlock()
+			return
+		default:
+		}
+
+		wait = interval
+		if idle := clock.Now().Sub(s.stats.LastActivity); idle < interval {
+			wait = interval - idle
+		} else if s.send(Event{}) == nil {
+			s.flush()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close stops the keepalives started by KeepAlive. Once it returns, no more
+// keepalives are written. It does not end the response, which ends when the
+// handler returns.
+func (s *ServerConn) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopKeepalive != nil {
+		close(s.stopKeepalive)
+		s.stopKeepalive = nil
+	}
+}
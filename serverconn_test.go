@@ -6,7 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func testCompleteServer(t *testing.T, events []Event, expect []byte) {
@@ -71,6 +75,37 @@ func TestServerConnDataMultiline(t *testing.T) {
 		[]byte("data: multi\ndata: line\ndata: message\n\n"))
 }
 
+func TestServerConnEmptyData(t *testing.T) {
+	testCompleteServer(t,
+		[]Event{Event{Data: []byte{}}},
+		[]byte("data:\n\n"))
+}
+
+func TestServerConnSendDone(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SendDone()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientConn(bufio.NewReader(w.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.IsDone() {
+		t.Errorf("Got event %#v, wanted a done event", ev)
+	}
+}
+
 func TestServerConnTrailingNewline(t *testing.T) {
 	testCompleteServer(t,
 		[]Event{Event{Data: []byte("ends in newline\n")}},
@@ -90,6 +125,117 @@ func TestServerConnWeirdEvent(t *testing.T) {
 		[]byte("event:  also leading space\nid:  4\nretry: 1000\ndata:   leading spaces\ndata: multiline\ndata: and ends with a newline\ndata:\n\n"))
 }
 
+func TestServerConnSendComment(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(CheckFrames(w, func(err error) {
+		t.Errorf("Unexpected report: %v", err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SendComment("padding\n\nsecond\r\nthird\rfourth")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ": padding\n:\n: second\n: third\n: fourth\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+	if conn.Stats().Comments != 1 {
+		t.Errorf("Got %v comments in Stats, wanted 1", conn.Stats().Comments)
+	}
+}
+
+func TestServerConnSendFrom(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"one line", "event: a\nid: 1\ndata: one line\n\n"},
+		{"multi\nline", "event: a\nid: 1\ndata: multi\ndata: line\n\n"},
+		{"ends in newline\n", "event: a\nid: 1\ndata: ends in newline\ndata:\n\n"},
+		{"", "event: a\nid: 1\ndata:\n\n"},
+		{long, "event: a\nid: 1\ndata: " + long + "\n\n"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		conn, err := NewServerConn(CheckFrames(w, func(err error) {
+			t.Errorf("Unexpected report: %v", err)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = conn.SendFrom("a", "1", strings.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := w.Body.String(); got != test.want {
+			t.Errorf("SendFrom(%#v) wrote %#v, but wanted %#v", test.data, got, test.want)
+		}
+
+		client, err := NewClientConn(bufio.NewReader(w.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err := client.Receive(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(ev.Data) != test.data {
+			t.Errorf("SendFrom(%#v) was received as %#v", test.data, string(ev.Data))
+		}
+	}
+}
+
+func TestServerConnDataEmptyLine(t *testing.T) {
+	testCompleteServer(t,
+		[]Event{Event{Data: []byte("a\n\nb")}},
+		[]byte("data: a\ndata: \ndata: b\n\n"))
+}
+
+func TestServerConnProfile(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Profile = Profile{
+		FieldOrder:        []string{"id", "data"},
+		NoSpaceAfterColon: true,
+		Keepalive:         " ping",
+	}
+
+	for _, ev := range []Event{weirdEvent, Event{}} {
+		err := conn.Send(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "id:  4\ndata:   leading spaces\ndata:multiline\ndata:and ends with a newline\ndata:\nevent:  also leading space\nretry:1000\n\n: ping\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+
+	client, err := NewClientConn(bufio.NewReader(w.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Eq(weirdEvent) {
+		t.Errorf("Got event %#v, wanted %#v", ev, weirdEvent)
+	}
+}
+
 func TestServerConnFlushes(t *testing.T) {
 	w := httptest.NewRecorder()
 	conn, err := NewServerConn(w)
@@ -109,6 +255,86 @@ func TestServerConnFlushes(t *testing.T) {
 	}
 }
 
+func TestServerConnStats(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conn.Stats().LastActivity.IsZero() {
+		t.Errorf("LastActivity set before anything was sent")
+	}
+
+	for _, ev := range []Event{Event{}, Event{Data: []byte("a")}, weirdEvent} {
+		err := conn.Send(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := conn.Stats()
+	if stats.Events != 2 {
+		t.Errorf("Got %v events, wanted 2", stats.Events)
+	}
+	if stats.Comments != 1 {
+		t.Errorf("Got %v comments, wanted 1", stats.Comments)
+	}
+	if stats.Bytes != int64(w.Body.Len()) {
+		t.Errorf("Got %v bytes, wanted %v", stats.Bytes, w.Body.Len())
+	}
+	if stats.LastActivity.IsZero() {
+		t.Errorf("LastActivity was not set")
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time                         { return time.Time(c) }
+func (c fixedClock) After(d time.Duration) <-chan time.Time { return nil }
+
+func TestServerConnStampSendTime(t *testing.T) {
+	sent := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.StampSendTime = true
+	conn.Clock = fixedClock(sent)
+
+	err = conn.Send(Event{Data: []byte("hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "sent-at: 1577836800000\ndata: hi\n\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("Got %#v, but wanted %#v", got, want)
+	}
+
+	client, err := NewClientConn(bufio.NewReader(w.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Clock = fixedClock(sent.Add(250 * time.Millisecond))
+
+	ev, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ev.Data) != "hi" {
+		t.Errorf("Got data %#v, wanted \"hi\"", string(ev.Data))
+	}
+	if got := client.Stats().LastLatency; got != 250*time.Millisecond {
+		t.Errorf("Got LastLatency %v, wanted 250ms", got)
+	}
+	if client.Stats().UnknownFields != 0 {
+		t.Errorf("ClientConn treated the send time as an unknown field")
+	}
+}
+
 func TestServerConnClientConnEndToEnd(t *testing.T) {
 	eventsToSend := make(chan Event)
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -157,7 +383,7 @@ func TestServerConnClientConnEndToEnd(t *testing.T) {
 				}
 				return
 			}
-			eventsReceived <- event
+			eventsReceived <- event.Clone()
 		}
 	}()
 
@@ -192,3 +418,154 @@ func TestServerConnClientConnEndToEnd(t *testing.T) {
 		t.Errorf("Got extra event")
 	}
 }
+
+// manualClock is a Clock whose time is set by the test, and whose After
+// channels all fire when the test sends on ticks.
+type manualClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time { return c.ticks }
+
+func (c *manualClock) set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+func TestServerConnKeepAlive(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := &manualClock{now: start, ticks: make(chan time.Time)}
+
+	w := httptest.NewRecorder()
+	conn, _ := NewServerConn(w)
+	conn.Clock = clock
+	conn.KeepAlive(10 * time.Second)
+
+	waitForComments := func(n int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for conn.Stats().Comments != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Got %v keepalives, wanted %v", conn.Stats().Comments, n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Idle for the whole interval.
+	clock.set(start.Add(10 * time.Second))
+	clock.ticks <- time.Time{}
+	waitForComments(1)
+
+	// An Event halfway through the next interval postpones the keepalive.
+	clock.set(start.Add(15 * time.Second))
+	conn.Send(Event{Data: []byte("x")})
+	clock.set(start.Add(20 * time.Second))
+	clock.ticks <- time.Time{}
+	clock.set(start.Add(25 * time.Second))
+	clock.ticks <- time.Time{}
+	waitForComments(2)
+
+	conn.Close()
+	select {
+	case clock.ticks <- time.Time{}:
+		t.Errorf("keepalive goroutine still running after Close")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	want := ":\n\ndata: x\n\n:\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+}
+
+func TestServerConnCarriageReturns(t *testing.T) {
+	testCompleteServer(t,
+		[]Event{Event{Data: []byte("a\rb\r\nc\r")}},
+		[]byte("data: a\ndata: b\ndata: c\ndata:\n\n"))
+
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"a\rb\r\nc", "a\nb\nc"},
+		{"10%\r20%\r30%", "10%\n20%\n30%"},
+		{"\r\r\n\n", "\n\n\n"},
+		{"ends in\r", "ends in\n"},
+	}
+
+	for _, test := range tests {
+		sends := map[string]func(*ServerConn) error{
+			"Send": func(conn *ServerConn) error {
+				return conn.Send(Event{Data: []byte(test.data)})
+			},
+			"SendFrom": func(conn *ServerConn) error {
+				// Reading a byte at a time splits CRLFs across reads.
+				return conn.SendFrom("", "", iotest.OneByteReader(strings.NewReader(test.data)))
+			},
+		}
+		for how, send := range sends {
+			w := httptest.NewRecorder()
+			conn, err := NewServerConn(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = send(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client, err := NewClientConn(bufio.NewReader(w.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, err := client.Receive(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(ev.Data) != test.want {
+				t.Errorf("%v(%#v) was received as %#v, wanted %#v", how, test.data, string(ev.Data), test.want)
+			}
+		}
+	}
+}
+
+func TestServerConnLineBreakInField(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := []Event{
+		{Event: "a\nb", Data: []byte("x")},
+		{ID: "1\r", Data: []byte("x")},
+		{ContentType: "text/plain\r\nevent: injected", Data: []byte("x")},
+	}
+	for _, ev := range bad {
+		if err := conn.Send(ev); err != ErrLineBreakInField {
+			t.Errorf("Send(%#v) returned %v, wanted %v", ev, err, ErrLineBreakInField)
+		}
+	}
+	if err := conn.SendFrom("a\rb", "", strings.NewReader("x")); err != ErrLineBreakInField {
+		t.Errorf("SendFrom returned %v, wanted %v", err, ErrLineBreakInField)
+	}
+
+	conn.Profile.Keepalive = "ping\ndata: injected"
+	if err := conn.Send(Event{}); err != ErrLineBreakInField {
+		t.Errorf("Keepalive was sent with error %v, wanted %v", err, ErrLineBreakInField)
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("Rejected Events wrote %#v", w.Body.String())
+	}
+}
@@ -0,0 +1,58 @@
+package evsrc
+
+import (
+	"time"
+)
+
+// Stats holds counters describing the traffic on a ClientConn or ServerConn.
+type Stats struct {
+	// Events is the number of Events received or sent, not counting
+	// keepalives.
+	Events int64
+
+	// Bytes is the number of bytes read from or written to the stream.
+	Bytes int64
+
+	// Comments is the number of comment lines received, or the number of
+	// keepalives sent.
+	Comments int64
+
+	// ParseWarnings is the number of lines a ClientConn ignored or tolerated
+	// despite them not being well formed. It is the sum of UnknownFields,
+	// InvalidRetries, and MidStreamBOMs. It is always zero for ServerConns, as
+	// are the counters it sums.
+	ParseWarnings int64
+
+	// UnknownFields is the number of lines ignored because their field name
+	// was not recognized.
+	UnknownFields int64
+
+	// InvalidRetries is the number of retry fields ignored because their value
+	// was not an integer.
+	InvalidRetries int64
+
+	// MidStreamBOMs is the number of UTF-8 byte order marks skipped anywhere
+	// other than the start of the stream.
+	MidStreamBOMs int64
+
+	// LastLatency is how long the last Event received took to arrive, as
+	// measured from the send time added by a ServerConn with StampSendTime
+	// set. It is zero if no Event has carried a send time, and always zero for
+	// ServerConns.
+	LastLatency time.Duration
+
+	// Lag is a smoothed estimate of how far behind the sender the receiver
+	// is, averaged over the latencies of recent Events that carried a send
+	// time. A Lag that keeps growing means the receiver is falling behind. It
+	// is always zero for ServerConns.
+	Lag time.Duration
+
+	// EventsPerSecond is the rate Events were received at over the most recent
+	// period of at least a second in which any were received. It is always
+	// zero for ServerConns.
+	EventsPerSecond float64
+
+	// LastActivity is the time bytes were last read from or written to the
+	// stream, or the zero Time if none have been.
+	LastActivity time.Time
+}
@@ -0,0 +1,66 @@
+package evsrc
+
+import (
+	"sync"
+)
+
+// Tee copies every Event received from src to both of the returned channels.
+//
+// The returned channels are unbuffered, and the next Event is not read from src
+// until the current one has been received from both, so the pair proceeds at
+// the pace of the slower consumer. Both channels must be drained until they are
+// closed, which happens after src is closed. The Event sent on the second
+// channel has its Data cloned, so each consumer owns the Data it receives.
+func Tee(src <-chan Event) (<-chan Event, <-chan Event) {
+	a := make(chan Event)
+	b := make(chan Event)
+
+	go func() {
+		defer close(a)
+		defer close(b)
+
+		for ev := range src {
+			evB := ev.Clone()
+
+			outA, outB := a, b
+			for outA != nil || outB != nil {
+				select {
+				case outA <- ev:
+					outA = nil
+				case outB <- evB:
+					outB = nil
+				}
+			}
+		}
+	}()
+
+	return a, b
+}
+
+// Merge forwards Events from all of srcs to the returned channel, in the order
+// they are received. Events from any single source stay in order, but there is
+// no ordering between sources.
+//
+// The returned channel is unbuffered, so a slow consumer blocks every source.
+// It is closed once all of srcs have been closed.
+func Merge(srcs ...<-chan Event) <-chan Event {
+	out := make(chan Event)
+
+	var wg sync.WaitGroup
+	wg.Add(len(srcs))
+	for _, src := range srcs {
+		go func(src <-chan Event) {
+			defer wg.Done()
+			for ev := range src {
+				out <- ev
+			}
+		}(src)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
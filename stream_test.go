@@ -0,0 +1,100 @@
+package evsrc
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func sendEvents(events []Event) <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for _, ev := range events {
+			ch <- ev
+		}
+	}()
+	return ch
+}
+
+func TestTee(t *testing.T) {
+	events := []Event{
+		Event{Data: []byte("1")},
+		Event{Data: []byte("2")},
+		Event{Data: []byte("3")},
+	}
+
+	a, b := Tee(sendEvents(events))
+
+	var wg sync.WaitGroup
+	var gotA, gotB []Event
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for ev := range a {
+			gotA = append(gotA, ev)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for ev := range b {
+			gotB = append(gotB, ev)
+		}
+	}()
+	wg.Wait()
+
+	for name, got := range map[string][]Event{"a": gotA, "b": gotB} {
+		if len(got) != len(events) {
+			t.Errorf("Got %v events on %v, wanted %v", len(got), name, len(events))
+			continue
+		}
+		for i := range got {
+			if !got[i].Eq(events[i]) {
+				t.Errorf("Got event %#v on %v, but wanted %#v", got[i], name, events[i])
+			}
+		}
+	}
+
+	if len(gotB) > 0 && &gotA[0].Data[0] == &gotB[0].Data[0] {
+		t.Errorf("Tee outputs share Data")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var srcs []<-chan Event
+	var want []string
+	for i := 0; i < 3; i++ {
+		var events []Event
+		for j := 0; j < 10; j++ {
+			data := strconv.Itoa(i*10 + j)
+			events = append(events, Event{Data: []byte(data)})
+			want = append(want, data)
+		}
+		srcs = append(srcs, sendEvents(events))
+	}
+
+	var got []string
+	for ev := range Merge(srcs...) {
+		got = append(got, string(ev.Data))
+	}
+
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("Got %v events, wanted %v", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Got events %v, wanted %v", got, want)
+			break
+		}
+	}
+}
+
+func TestMergeNothing(t *testing.T) {
+	_, ok := <-Merge()
+	if ok {
+		t.Errorf("Merge() produced an event")
+	}
+}
@@ -0,0 +1,61 @@
+package evsrc
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// A StreamError is an application-level error sent in-band on an event stream,
+// as the JSON Data of an Event named ErrorEventName:
+//
+//	{"code": "not_found", "message": "no such job", "retryable": false}
+type StreamError struct {
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+func (e *StreamError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return e.Code + ": " + e.Message
+}
+
+// internalStreamError is sent in place of errors that are not StreamErrors,
+// whose text may hold details clients shouldn't see, such as file paths or
+// responses from other services.
+var internalStreamError = &StreamError{Code: "internal", Message: "internal error"}
+
+// errorEvent returns the Event carrying err, or internalStreamError if err is
+// not a *StreamError.
+func errorEvent(err error) Event {
+	var se *StreamError
+	if !errors.As(err, &se) {
+		se = internalStreamError
+	}
+
+	data, _ := json.Marshal(se)
+	return Event{Event: ErrorEventName, Data: data}
+}
+
+// SendError sends a StreamError with the given fields.
+func (s *ServerConn) SendError(code, message string, retryable bool) error {
+	return s.Send(errorEvent(&StreamError{code, message, retryable}))
+}
+
+// Err returns the *StreamError carried by e if it is named ErrorEventName, or
+// nil otherwise. If the Data is not a JSON StreamError, it is used as the
+// Message.
+func (e Event) Err() error {
+	if e.Event != ErrorEventName {
+		return nil
+	}
+
+	se := &StreamError{}
+	err := json.Unmarshal(e.Data, se)
+	if err != nil || se.Message == "" && se.Code == "" {
+		se = &StreamError{Message: string(e.Data)}
+	}
+	return se
+}
@@ -0,0 +1,56 @@
+package evsrc
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerConnSendError(t *testing.T) {
+	w := httptest.NewRecorder()
+	conn, err := NewServerConn(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.SendError("overloaded", "try later", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: error\ndata: {\"code\":\"overloaded\",\"message\":\"try later\",\"retryable\":true}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("Got %#v, but wanted %#v", got, want)
+	}
+
+	client, err := NewClientConn(bufio.NewReader(w.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := client.Receive(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	se, ok := ev.Err().(*StreamError)
+	if !ok {
+		t.Fatalf("Got Err() = %#v, wanted a *StreamError", ev.Err())
+	}
+	if *se != (StreamError{"overloaded", "try later", true}) {
+		t.Errorf("Got %#v", se)
+	}
+	if se.Error() != "overloaded: try later" {
+		t.Errorf("Got error text %#v", se.Error())
+	}
+}
+
+func TestEventErr(t *testing.T) {
+	if err := (Event{Data: []byte("fine")}).Err(); err != nil {
+		t.Errorf("Got Err() = %v for an ordinary event", err)
+	}
+
+	err := Event{Event: ErrorEventName, Data: []byte("plain text")}.Err()
+	if err == nil || err.Error() != "plain text" {
+		t.Errorf("Got Err() = %v, wanted \"plain text\"", err)
+	}
+}
@@ -0,0 +1,115 @@
+package evsrc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// ErrHTTP10 is returned when refusing to stream to an HTTP/1.0 client.
+// HTTP/1.0 has no chunked encoding, so intermediaries commonly buffer such
+// responses until they end, which for an event stream is never.
+var ErrHTTP10 = errors.New("event streams are not served over HTTP/1.0")
+
+// refuseHTTP10 responds with 505 HTTP Version Not Supported and returns
+// ErrHTTP10 if r was made with HTTP/1.0 or earlier.
+func refuseHTTP10(w http.ResponseWriter, r *http.Request) error {
+	if r.ProtoAtLeast(1, 1) {
+		return nil
+	}
+
+	http.Error(w, ErrHTTP10.Error(), http.StatusHTTPVersionNotSupported)
+	return ErrHTTP10
+}
+
+// Event names used by conventions in this package.
+const (
+	// DoneEventName is the name of the Event sent by ServerConn.SendDone.
+	DoneEventName = "done"
+
+	// ErrorEventName is the name of StreamError Events.
+	ErrorEventName = "error"
+)
+
+// StreamFunc streams the progress of a single operation as the response to r.
+//
+// It takes over w as NewServerConn does, then calls fn with a send function
+// that writes Events to the stream. send fails without writing once r's
+// context is done, returning the context's cause (see context.Cause), which
+// fn should take as a signal to stop. When fn returns, StreamFunc sends a final
+// Event and returns: a StreamError Event if fn failed, or an Event named
+// DoneEventName with empty Data otherwise. The caller's handler should then
+// return to finish the response.
+//
+// Only a *StreamError returned by fn (possibly wrapped) is sent to the client
+// as it is, so fn should return one for errors the client should see. Other
+// errors may hold details that must not leak to clients, so a StreamError with
+// the code "internal" is sent in their place, and the error is logged with the
+// log package unless r's context is done.
+//
+// Requests made with HTTP/1.0 are refused with a 505 status without calling fn,
+// and StreamFunc returns ErrHTTP10. If w can't stream, the request is
+// answered with a 500 status and the *CapabilityError from NewServerConn is
+// returned.
+//
+// StreamFunc returns fn's error if it had one, or otherwise the first error
+// encountered while sending.
+func StreamFunc(w http.ResponseWriter, r *http.Request, fn func(send func(Event) error) error) error {
+	err := refuseHTTP10(w, r)
+	if err != nil {
+		return err
+	}
+
+	conn, err := NewServerConn(w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+
+	ctx := r.Context()
+	var sendErr error
+	send := func(e Event) error {
+		if sendErr != nil {
+			return sendErr
+		}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		sendErr = conn.Send(e)
+		return sendErr
+	}
+
+	fnErr := fn(send)
+
+	final := Event{Event: DoneEventName, Data: []byte{}}
+	if fnErr != nil {
+		final = errorEvent(fnErr)
+
+		var se *StreamError
+		if !errors.As(fnErr, &se) && ctx.Err() == nil {
+			log.Printf("evsrc: stream %v %v failed: %v", r.Method, r.URL.Path, fnErr)
+		}
+	}
+	err = send(final)
+
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// StreamHandler returns an http.Handler that streams Events from fn, using
+// StreamFunc. fn is called with the request's context and the value of its
+// Last-Event-ID header, which is empty unless the client is resuming a stream.
+//
+// As with StreamFunc, an Event named DoneEventName is sent when fn returns nil,
+// so fn should only do so once the stream is finished. A stream that never
+// finishes should run until ctx is done.
+func StreamHandler(fn func(ctx context.Context, lastEventID string, send func(Event) error) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamFunc(w, r, func(send func(Event) error) error {
+			return fn(r.Context(), r.Header.Get("Last-Event-ID"), send)
+		})
+	})
+}
@@ -0,0 +1,144 @@
+package evsrc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStreamFunc(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	err := StreamFunc(w, r, func(send func(Event) error) error {
+		for _, step := range []string{"1", "2"} {
+			err := send(Event{Event: "progress", Data: []byte(step)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: progress\ndata: 1\n\nevent: progress\ndata: 2\n\nevent: done\ndata:\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+}
+
+func TestStreamFuncError(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+
+	failure := &StreamError{Code: "not_found", Message: "no such job"}
+	err := StreamFunc(w, r, func(send func(Event) error) error {
+		return fmt.Errorf("looking up job: %w", failure)
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Got err = %v, wanted %v", err, failure)
+	}
+
+	want := "event: error\ndata: {\"code\":\"not_found\",\"message\":\"no such job\",\"retryable\":false}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+}
+
+func TestStreamFuncInternalError(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/jobs", nil)
+
+	failure := errors.New("open /srv/secrets/db.conf: permission denied")
+	err := StreamFunc(w, r, func(send func(Event) error) error {
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Got err = %v, wanted %v", err, failure)
+	}
+
+	want := "event: error\ndata: {\"code\":\"internal\",\"message\":\"internal error\",\"retryable\":false}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+	if !strings.Contains(logged.String(), failure.Error()) {
+		t.Errorf("Got log %#v, wanted it to hold the error", logged.String())
+	}
+}
+
+func TestStreamFuncCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	err := StreamFunc(w, r, func(send func(Event) error) error {
+		cancel()
+		return send(Event{Data: []byte("too late")})
+	})
+	if err != context.Canceled {
+		t.Errorf("Got err = %v, wanted %v", err, context.Canceled)
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("Got %#v written after cancellation", w.Body.String())
+	}
+}
+
+func TestStreamFuncRefusesHTTP10(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/1.0", 1, 0
+
+	called := false
+	err := StreamFunc(w, r, func(send func(Event) error) error {
+		called = true
+		return nil
+	})
+	if err != ErrHTTP10 {
+		t.Errorf("Got err = %v, wanted %v", err, ErrHTTP10)
+	}
+	if called {
+		t.Errorf("StreamFunc called fn for an HTTP/1.0 request")
+	}
+	if w.Code != http.StatusHTTPVersionNotSupported {
+		t.Errorf("Got status %v, wanted %v", w.Code, http.StatusHTTPVersionNotSupported)
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	type ctxKey struct{}
+
+	h := StreamHandler(func(ctx context.Context, lastEventID string, send func(Event) error) error {
+		if ctx.Value(ctxKey{}) != "request" {
+			t.Errorf("fn was not given the request's context")
+		}
+		return send(Event{ID: lastEventID + "+1", Data: []byte("next")})
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "request"))
+	r.Header.Set("Last-Event-ID", "41")
+	h.ServeHTTP(w, r)
+
+	want := "id: 41+1\ndata: next\n\nevent: done\ndata:\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Got %#v, but wanted %#v", got, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Got Content-Type %q", ct)
+	}
+}
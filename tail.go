@@ -0,0 +1,269 @@
+package evsrc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is the poll interval used when Follower.PollInterval is
+// zero.
+const defaultPollInterval = 250 * time.Millisecond
+
+// A Tail turns lines of text into Events, as returned by TailReader and
+// FollowFile. Its Events are typically forwarded with ServerConn.Send:
+//
+//	t := evsrc.FollowFile("/var/log/app.log", nil)
+//	defer t.Stop()
+//	for ev := range t.Events() {
+//		if err := conn.Send(ev); err != nil {
+//			break
+//		}
+//	}
+type Tail struct {
+	lineToEvent func([]byte) Event
+
+	events   chan Event
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	err error
+}
+
+func newTail(lineToEvent func([]byte) Event) *Tail {
+	if lineToEvent == nil {
+		lineToEvent = func(line []byte) Event {
+			return Event{Data: line}
+		}
+	}
+
+	return &Tail{
+		lineToEvent: lineToEvent,
+		events:      make(chan Event),
+		stop:        make(chan struct{}),
+	}
+}
+
+// TailReader reads lines from r and sends an Event for each on the channel
+// returned by Events, until r returns an error (including io.EOF) or Stop is
+// called.
+//
+// Each line is given to lineToEvent without its line ending, in a newly
+// allocated slice which lineToEvent may keep. If lineToEvent is nil, each
+// line becomes the Data of an unnamed Event. A final line without a line
+// ending is sent as well.
+func TailReader(r io.Reader, lineToEvent func([]byte) Event) *Tail {
+	t := newTail(lineToEvent)
+
+	go func() {
+		defer close(t.events)
+
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 && !t.emit(line) {
+				return
+			}
+			if err != nil {
+				if err != io.EOF {
+					t.err = err
+				}
+				return
+			}
+		}
+	}()
+
+	return t
+}
+
+// FollowFile is like TailReader, but follows the file at path as it grows,
+// like "tail -F". It is shorthand for starting a Follower with default
+// settings.
+func FollowFile(path string, lineToEvent func([]byte) Event) *Tail {
+	return Follower{Path: path, LineToEvent: lineToEvent}.Start()
+}
+
+// A Follower follows a file as it grows, like "tail -F", sending an Event for
+// each line written to it.
+//
+// A Follower handles log rotation: when a different file appears at Path, the
+// rest of the old file is sent and the new one is followed from its start.
+// When the file shrinks below the part already read, it is assumed to have
+// been truncated and is followed from its new start. Either way, a final line
+// of the old contents without a line ending is sent first. If Path does not
+// exist for a while (for example, between a rotation's rename and the
+// creation of the new file), the Follower waits for it to reappear.
+type Follower struct {
+	// Path is the file to follow.
+	Path string
+
+	// LineToEvent converts lines to Events, as for TailReader.
+	LineToEvent func([]byte) Event
+
+	// PollInterval is how often the file is checked for new data once the
+	// Follower has caught up with its end. If zero, 250ms is used.
+	PollInterval time.Duration
+
+	// Clock is used to wait between polls. If nil, the system clock is used.
+	Clock Clock
+}
+
+// Start starts following the file from its current end, so only lines
+// written after Start is called are sent. The Events channel of the returned
+// Tail is only closed if Stop is called or the file cannot be read.
+func (fl Follower) Start() *Tail {
+	t := newTail(fl.LineToEvent)
+
+	go func() {
+		defer close(t.events)
+		t.err = t.follow(fl)
+	}()
+
+	return t
+}
+
+func (t *Tail) follow(fl Follower) error {
+	path := fl.Path
+	pollInterval := fl.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	clock := clockOrSystem(fl.Clock)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(f)
+	var partial []byte
+	for {
+		chunk, err := br.ReadBytes('\n')
+		partial = append(partial, chunk...)
+
+		if err == nil {
+			if !t.emit(partial) {
+				return nil
+			}
+			partial = nil
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		// Caught up with the end of the file; see whether it was rotated or
+		// truncated before waiting for more.
+		current, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			// Mid-rotation; keep reading the old file until a new one appears.
+
+		case err != nil:
+			return err
+
+		case !os.SameFile(info, current):
+			if len(partial) > 0 && !t.emit(partial) {
+				return nil
+			}
+			partial = nil
+
+			newFile, err := os.Open(path)
+			if os.IsNotExist(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			info, err = newFile.Stat()
+			if err != nil {
+				newFile.Close()
+				return err
+			}
+
+			f.Close()
+			f = newFile
+			br.Reset(f)
+			continue
+
+		default:
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+
+			if current.Size() < offset {
+				if len(partial) > 0 && !t.emit(partial) {
+					return nil
+				}
+				partial = nil
+
+				_, err = f.Seek(0, io.SeekStart)
+				if err != nil {
+					return err
+				}
+				br.Reset(f)
+				continue
+			}
+		}
+
+		select {
+		case <-clock.After(pollInterval):
+		case <-t.stop:
+			return nil
+		}
+	}
+}
+
+// emit converts line to an Event and sends it, returning false if the Tail
+// was stopped first.
+func (t *Tail) emit(line []byte) bool {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	select {
+	case t.events <- t.lineToEvent(append([]byte{}, line...)):
+		return true
+	case <-t.stop:
+		return false
+	}
+}
+
+// Events returns the channel Events are sent on. It is closed when the Tail
+// finishes, after which Err reports why.
+func (t *Tail) Events() <-chan Event {
+	return t.events
+}
+
+// Stop makes the Tail finish. Events already being read by TailReader are
+// discarded, but the read itself cannot be interrupted, so the goroutine
+// reading r exits only once that read returns.
+func (t *Tail) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+}
+
+// Err returns the error that made the Tail finish, or nil if it reached the
+// end of its reader or was stopped. It must only be called once the Events
+// channel is closed.
+func (t *Tail) Err() error {
+	return t.err
+}
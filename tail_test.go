@@ -0,0 +1,191 @@
+package evsrc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestTailReader(t *testing.T) {
+	r := strings.NewReader("first\r\nsecond\n\nlast")
+	tail := TailReader(r, func(line []byte) Event {
+		return Event{Event: "log", Data: line}
+	})
+
+	var got []string
+	for ev := range tail.Events() {
+		if ev.Event != "log" {
+			t.Errorf("got Event name %q, wanted log", ev.Event)
+		}
+		if ev.Data == nil {
+			t.Errorf("got nil Data for line %v", len(got))
+		}
+		got = append(got, string(ev.Data))
+	}
+
+	if s := strings.Join(got, "|"); s != "first|second||last" {
+		t.Errorf("got lines %q, wanted %q", s, "first|second||last")
+	}
+	if tail.Err() != nil {
+		t.Errorf("got error %v, wanted nil", tail.Err())
+	}
+}
+
+func TestTailReaderError(t *testing.T) {
+	wantErr := errors.New("broken")
+	tail := TailReader(iotest.TimeoutReader(strings.NewReader("a\nb\n")), nil)
+	for range tail.Events() {
+	}
+	if tail.Err() != iotest.ErrTimeout {
+		t.Errorf("got error %v, wanted %v", tail.Err(), iotest.ErrTimeout)
+	}
+
+	tail = TailReader(errorReader{wantErr}, nil)
+	for range tail.Events() {
+	}
+	if tail.Err() != wantErr {
+		t.Errorf("got error %v, wanted %v", tail.Err(), wantErr)
+	}
+}
+
+type errorReader struct{ err error }
+
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestTailReaderStop(t *testing.T) {
+	tail := TailReader(strings.NewReader("a\nb\nc\n"), nil)
+	ev := <-tail.Events()
+	if string(ev.Data) != "a" {
+		t.Errorf("got first line %q, wanted %q", ev.Data, "a")
+	}
+
+	tail.Stop()
+	tail.Stop()
+	for range tail.Events() {
+	}
+	if tail.Err() != nil {
+		t.Errorf("got error %v, wanted nil", tail.Err())
+	}
+}
+
+// pollClock is a Clock whose After channels are handed to the test on
+// waiting, so that the test knows when a Follower has caught up and can wake
+// it after changing the file.
+type pollClock struct {
+	waiting chan chan time.Time
+}
+
+func (c pollClock) Now() time.Time { return time.Time{} }
+
+func (c pollClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.waiting <- ch
+	return ch
+}
+
+func TestFollowFileRotation(t *testing.T) {
+	dir, err := os.MkdirTemp("", "evsrc-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	appendFile := func(name, text string) {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = f.WriteString(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock := pollClock{make(chan chan time.Time, 1)}
+
+	// whenIdle waits for the Follower to catch up with the file, runs
+	// change, then wakes the Follower to notice it.
+	whenIdle := func(change func()) {
+		t.Helper()
+		select {
+		case wake := <-clock.waiting:
+			change()
+			wake <- time.Time{}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the Follower to poll")
+		}
+	}
+
+	expect := func(tail *Tail, want string) {
+		t.Helper()
+		select {
+		case ev, ok := <-tail.Events():
+			if !ok {
+				t.Fatalf("Tail finished early with error %v", tail.Err())
+			}
+			if string(ev.Data) != want {
+				t.Errorf("got line %q, wanted %q", ev.Data, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	appendFile(path, "before follow\n")
+
+	tail := Follower{Path: path, Clock: clock}.Start()
+	defer tail.Stop()
+
+	whenIdle(func() { appendFile(path, "one\ntw") })
+	expect(tail, "one")
+	whenIdle(func() { appendFile(path, "o\n") })
+	expect(tail, "two")
+
+	// Rotate: the old file keeps a partial line, and a new file appears.
+	whenIdle(func() {
+		appendFile(path, "end of old")
+		err := os.Rename(path, path+".1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendFile(path, "new file\n")
+	})
+	expect(tail, "end of old")
+	expect(tail, "new file")
+
+	// Truncate in place, leaving a partial line behind. Like "tail -F",
+	// truncation is only noticed if the file ends up shorter than it was.
+	whenIdle(func() { appendFile(path, "unfinished") })
+	whenIdle(func() {
+		err := os.WriteFile(path, []byte("short\n"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	expect(tail, "unfinished")
+	expect(tail, "short")
+
+	tail.Stop()
+	for range tail.Events() {
+	}
+	if tail.Err() != nil {
+		t.Errorf("got error %v, wanted nil", tail.Err())
+	}
+}
+
+func TestFollowFileMissing(t *testing.T) {
+	tail := FollowFile(filepath.Join(os.TempDir(), "evsrc-does-not-exist"), nil)
+	for range tail.Events() {
+	}
+	if !os.IsNotExist(tail.Err()) {
+		t.Errorf("got error %v, wanted a not-exist error", tail.Err())
+	}
+}
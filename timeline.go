@@ -0,0 +1,96 @@
+package evsrc
+
+import (
+	"sync"
+	"time"
+)
+
+// A Timeline keeps a bounded window of recently received Events, so that
+// recent history can be shown without a separate history request.
+//
+// Timelines are safe for concurrent use.
+type Timeline struct {
+	// Clock is used to age out Events. If nil, the system clock is used. It
+	// must be set before the first call to Add.
+	Clock Clock
+
+	maxEvents int
+	maxAge    time.Duration
+
+	mu      sync.Mutex
+	entries []timelineEntry
+}
+
+type timelineEntry struct {
+	at    time.Time
+	event Event
+}
+
+// NewTimeline returns a Timeline holding at most maxEvents Events, none older
+// than maxAge. A zero limit is not enforced.
+func NewTimeline(maxEvents int, maxAge time.Duration) *Timeline {
+	return &Timeline{maxEvents: maxEvents, maxAge: maxAge}
+}
+
+// Add records a copy of e as received now.
+func (t *Timeline) Add(e Event) {
+	now := clockOrSystem(t.Clock).Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries = append(t.entries, timelineEntry{now, e.Clone()})
+	if t.maxEvents > 0 && len(t.entries) > t.maxEvents {
+		t.entries = append(t.entries[:0], t.entries[len(t.entries)-t.maxEvents:]...)
+	}
+	t.prune(now)
+}
+
+func (t *Timeline) prune(now time.Time) {
+	if t.maxAge <= 0 {
+		return
+	}
+
+	cutoff := now.Add(-t.maxAge)
+	i := 0
+	for i < len(t.entries) && t.entries[i].at.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		t.entries = append(t.entries[:0], t.entries[i:]...)
+	}
+}
+
+// Events returns the Events in the Timeline, oldest first. The caller must
+// not modify their Data.
+func (t *Timeline) Events() []Event {
+	return t.Query("", "", "")
+}
+
+// Query returns the Events in the Timeline named name (or with any name, if
+// name is empty), from the Event with ID fromID to the one with ID toID
+// inclusive, oldest first. An empty fromID starts from the oldest Event, and
+// an empty toID runs to the newest. If fromID is not in the Timeline, Query
+// returns nothing. The caller must not modify the returned Events' Data.
+func (t *Timeline) Query(name, fromID, toID string) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(clockOrSystem(t.Clock).Now())
+
+	var events []Event
+	started := fromID == ""
+	for _, entry := range t.entries {
+		e := entry.event
+		if !started && e.ID == fromID {
+			started = true
+		}
+		if started && (name == "" || e.Event == name) {
+			events = append(events, e)
+		}
+		if started && toID != "" && e.ID == toID {
+			break
+		}
+	}
+	return events
+}
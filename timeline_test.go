@@ -0,0 +1,62 @@
+package evsrc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type steppingClock struct {
+	now time.Time
+}
+
+func (c *steppingClock) Now() time.Time                         { return c.now }
+func (c *steppingClock) After(d time.Duration) <-chan time.Time { return nil }
+
+func timelineIDs(events []Event) []string {
+	var ids []string
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestTimelineQuery(t *testing.T) {
+	tl := NewTimeline(4, 0)
+	for i, name := range []string{"a", "b", "a", "b", "a"} {
+		tl.Add(Event{Event: name, ID: string(rune('1' + i)), Data: []byte("x")})
+	}
+
+	tests := []struct {
+		name, from, to string
+		want           string
+	}{
+		{"", "", "", "2345"},
+		{"a", "", "", "35"},
+		{"", "3", "4", "34"},
+		{"b", "3", "", "4"},
+		{"", "1", "", ""},
+	}
+
+	for _, test := range tests {
+		got := timelineIDs(tl.Query(test.name, test.from, test.to))
+		if gotStr := strings.Join(got, ""); gotStr != test.want {
+			t.Errorf("Query(%#v, %#v, %#v) = %v, wanted %v", test.name, test.from, test.to, gotStr, test.want)
+		}
+	}
+}
+
+func TestTimelineMaxAge(t *testing.T) {
+	clock := &steppingClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tl := NewTimeline(0, time.Minute)
+	tl.Clock = clock
+
+	tl.Add(Event{ID: "1"})
+	clock.now = clock.now.Add(40 * time.Second)
+	tl.Add(Event{ID: "2"})
+	clock.now = clock.now.Add(40 * time.Second)
+
+	if got := strings.Join(timelineIDs(tl.Events()), ""); got != "2" {
+		t.Errorf("Got events %v, wanted only 2", got)
+	}
+}
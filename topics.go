@@ -0,0 +1,228 @@
+package evsrc
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Topics holds a separate Broker for each of any number of named topics,
+// creating each Broker the first time its topic is used.
+//
+// Topics are never removed, so the names that can be subscribed to should be
+// limited, for example by the authorize function given to Handler.
+//
+// A Topics can be divided into namespaces, such as one per tenant of a
+// multi-tenant service, each with its own topics, Brokers, and limits; see
+// Namespace.
+//
+// The zero Topics is ready to use. Topics are safe for concurrent use.
+type Topics struct {
+	// NewBroker, if non-nil, creates the Broker for a topic, so that topics
+	// can be configured differently. If nil, the package's NewBroker is used.
+	// It must be set before the first topic is used.
+	NewBroker func(topic string) *Broker
+
+	// MaxSubscribers, if positive, limits how many requests Handler keeps
+	// subscribed at once. Further requests are refused with a 503 Service
+	// Unavailable status. Subscriptions made directly through Brokers are not
+	// counted. It must be set before Handler is used.
+	MaxSubscribers int
+
+	// ConfigureNamespace, if non-nil, is called with each namespace when
+	// Namespace creates it, before it is returned, so that it can be given
+	// its own MaxSubscribers or NewBroker. As with Broker's, it is called
+	// without the Topics' lock held, and may be called for more than one new
+	// namespace when Namespace is called concurrently with a new name.
+	ConfigureNamespace func(name string, ns *Topics)
+
+	mu          sync.Mutex
+	brokers     map[string]*Broker
+	namespaces  map[string]*Topics
+	closed      bool
+	subscribers int
+	refused     int
+}
+
+// Broker returns the Broker for topic, creating it if needed.
+func (t *Topics) Broker(topic string) *Broker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.brokers[topic]
+	if ok {
+		return b
+	}
+
+	b = t.newBroker(topic)
+	if t.closed {
+		b.Close()
+	}
+
+	if t.brokers == nil {
+		t.brokers = make(map[string]*Broker)
+	}
+	t.brokers[topic] = b
+	return b
+}
+
+func (t *Topics) newBroker(topic string) *Broker {
+	if t.NewBroker != nil {
+		return t.NewBroker(topic)
+	}
+	return NewBroker()
+}
+
+// Namespace returns the Topics for the namespace name within t, creating it
+// if needed. A namespace's topics are separate from t's and from every other
+// namespace's, even where their names are the same, so tenants sharing a
+// server can't see each other's Events, and their Brokers' Replay buffers are
+// separate too.
+//
+// A new namespace starts with t's MaxSubscribers, and unless
+// ConfigureNamespace replaces it, a NewBroker that calls t's with name and the
+// topic joined by a slash, such as "tenant/news", so that t's NewBroker can
+// configure Brokers per tenant. Closing t closes its namespaces.
+func (t *Topics) Namespace(name string) *Topics {
+	t.mu.Lock()
+	ns, ok := t.namespaces[name]
+	t.mu.Unlock()
+	if ok {
+		return ns
+	}
+
+	ns = &Topics{
+		NewBroker: func(topic string) *Broker {
+			return t.newBroker(name + "/" + topic)
+		},
+		MaxSubscribers: t.MaxSubscribers,
+	}
+	if t.ConfigureNamespace != nil {
+		t.ConfigureNamespace(name, ns)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if existing, ok := t.namespaces[name]; ok {
+		// Another call created the namespace while this one configured it.
+		return existing
+	}
+	if t.closed {
+		ns.Close()
+	}
+
+	if t.namespaces == nil {
+		t.namespaces = make(map[string]*Topics)
+	}
+	t.namespaces[name] = ns
+	return ns
+}
+
+// Subscribers returns the number of current subscribers to t's topics, not
+// counting those of its namespaces.
+func (t *Topics) Subscribers() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, b := range t.brokers {
+		n += b.Subscribers()
+	}
+	return n
+}
+
+// Stats returns the BrokerStats of t's topics added together, not counting
+// those of its namespaces, so that each namespace can be monitored
+// separately. Refused also counts the requests Handler refused for exceeding
+// t's MaxSubscribers.
+func (t *Topics) Stats() BrokerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := BrokerStats{Refused: t.refused}
+	for _, b := range t.brokers {
+		s := b.Stats()
+		stats.Subscribers += s.Subscribers
+		stats.Published += s.Published
+		stats.Dropped += s.Dropped
+		stats.Refused += s.Refused
+	}
+	return stats
+}
+
+// Publish publishes e to the subscribers of topic.
+func (t *Topics) Publish(topic string, e Event) {
+	t.Broker(topic).Publish(e)
+}
+
+// Close closes every topic's Broker and every namespace, including those
+// created later.
+func (t *Topics) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for _, b := range t.brokers {
+		b.Close()
+	}
+	for _, ns := range t.namespaces {
+		ns.Close()
+	}
+}
+
+// admit counts a new subscriber for Handler, returning false if it would
+// exceed MaxSubscribers.
+func (t *Topics) admit() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.MaxSubscribers > 0 && t.subscribers >= t.MaxSubscribers {
+		t.refused++
+		return false
+	}
+	t.subscribers++
+	return true
+}
+
+func (t *Topics) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subscribers--
+}
+
+// Handler returns an http.Handler that subscribes each request to the topic
+// named by its "topic" path value, as set by an http.ServeMux pattern such as
+// "GET /streams/{topic}".
+//
+// If authorize is non-nil, it is called before subscribing, and if it returns
+// an error, the request is refused with a 403 Forbidden status and the error's
+// text. Requests beyond MaxSubscribers are refused after authorization.
+func (t *Topics) Handler(authorize func(r *http.Request, topic string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topic := r.PathValue("topic")
+
+		if authorize != nil {
+			err := authorize(r, topic)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		if !t.admit() {
+			http.Error(w, ErrTooManySubscribers.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer t.release()
+
+		t.Broker(topic).Subscribe(w, r)
+	})
+}
+
+// Mount registers Handler(authorize) on mux for pattern, which must contain
+// a {topic} wildcard:
+//
+//	topics.Mount(mux, "GET /streams/{topic}", nil)
+func (t *Topics) Mount(mux *http.ServeMux, pattern string, authorize func(r *http.Request, topic string) error) {
+	mux.Handle(pattern, t.Handler(authorize))
+}
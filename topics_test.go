@@ -0,0 +1,187 @@
+// The ServeMux patterns used here need Go 1.22 routing.
+//go:debug httpmuxgo121=0
+
+package evsrc
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTopicsMount(t *testing.T) {
+	var topics Topics
+	defer topics.Close()
+
+	mux := http.NewServeMux()
+	topics.Mount(mux, "GET /streams/{topic}", func(r *http.Request, topic string) error {
+		if topic == "secret" {
+			return errors.New("not allowed")
+		}
+		return nil
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/streams/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Got status %v for an unauthorized topic, wanted %v", resp.StatusCode, http.StatusForbidden)
+	}
+
+	resp, err = http.Get(server.URL + "/streams/news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitForSubscribers(t, topics.Broker("news"), 1)
+
+	topics.Publish("sports", Event{Data: []byte("not for news")})
+	topics.Publish("news", Event{Data: []byte("headline")})
+
+	client, _ := NewClientConn(bufio.NewReader(resp.Body))
+	ev, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ev.Data) != "headline" {
+		t.Errorf("Got event %#v, wanted only the news topic's", ev)
+	}
+
+	if topics.Broker("news") != topics.Broker("news") {
+		t.Errorf("Broker returned a different Broker for the same topic")
+	}
+}
+
+func TestTopicsNewBroker(t *testing.T) {
+	topics := Topics{NewBroker: func(topic string) *Broker {
+		b := NewBroker()
+		b.QueueSize = len(topic)
+		return b
+	}}
+
+	if q := topics.Broker("four").QueueSize; q != 4 {
+		t.Errorf("Got QueueSize %v, wanted the Broker from NewBroker", q)
+	}
+
+	topics.Close()
+	err := topics.Broker("later").Subscribe(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Errorf("Subscribe to a topic created after Close returned %v", err)
+	}
+}
+
+func TestTopicsNamespace(t *testing.T) {
+	var created []string
+	topics := Topics{
+		NewBroker: func(topic string) *Broker {
+			created = append(created, topic)
+			return NewBroker()
+		},
+		ConfigureNamespace: func(name string, ns *Topics) {
+			ns.MaxSubscribers = 1
+		},
+	}
+	defer topics.Close()
+
+	a := topics.Namespace("a")
+	if topics.Namespace("a") != a {
+		t.Errorf("Namespace returned a different Topics for the same name")
+	}
+	if a.Broker("news") == topics.Namespace("b").Broker("news") || a.Broker("news") == topics.Broker("news") {
+		t.Errorf("Namespaces share a Broker")
+	}
+	if len(created) != 3 || created[0] != "a/news" || created[1] != "b/news" || created[2] != "news" {
+		t.Errorf("NewBroker was called with %#v", created)
+	}
+
+	mux := http.NewServeMux()
+	a.Mount(mux, "GET /a/{topic}", nil)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/a/news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitForSubscribers(t, a.Broker("news"), 1)
+
+	if n := a.Subscribers(); n != 1 {
+		t.Errorf("Namespace has %v subscribers, wanted 1", n)
+	}
+	if n := topics.Subscribers(); n != 0 {
+		t.Errorf("Parent has %v subscribers, wanted 0", n)
+	}
+
+	second, err := http.Get(server.URL + "/a/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+	if second.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Got status %v beyond MaxSubscribers, wanted %v", second.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	topics.Namespace("b").Publish("news", Event{Data: []byte("for b")})
+	a.Publish("news", Event{Data: []byte("for a")})
+
+	client, _ := NewClientConn(bufio.NewReader(resp.Body))
+	ev, err := client.ReceiveOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ev.Data) != "for a" {
+		t.Errorf("Got event %#v, wanted only namespace a's", ev)
+	}
+
+	want := BrokerStats{Subscribers: 1, Published: 1, Refused: 1}
+	if got := a.Stats(); got != want {
+		t.Errorf("Got namespace stats %+v, wanted %+v", got, want)
+	}
+	if got := topics.Stats(); got != (BrokerStats{}) {
+		t.Errorf("Got parent stats %+v, wanted none", got)
+	}
+
+	topics.Close()
+	if _, err := client.ReceiveOwned(); err == nil {
+		t.Errorf("Stream continued after the parent Topics was closed")
+	}
+}
+
+func TestTopicsConfigureNamespace(t *testing.T) {
+	topics := &Topics{MaxSubscribers: 2}
+	topics.ConfigureNamespace = func(name string, ns *Topics) {
+		// Each of these takes the parent's lock.
+		topics.Stats()
+		topics.Publish("news", Event{Data: []byte("created " + name)})
+		if name == "big" {
+			ns.MaxSubscribers = 100
+		}
+	}
+	defer topics.Close()
+
+	done := make(chan struct{})
+	go func() {
+		topics.Namespace("a")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Namespace deadlocked with a ConfigureNamespace using the Topics")
+	}
+
+	if n := topics.Namespace("a").MaxSubscribers; n != 2 {
+		t.Errorf("Namespace has MaxSubscribers %v, wanted its parent's 2", n)
+	}
+	if n := topics.Namespace("big").MaxSubscribers; n != 100 {
+		t.Errorf("Namespace has MaxSubscribers %v, wanted 100 from ConfigureNamespace", n)
+	}
+}
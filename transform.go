@@ -0,0 +1,87 @@
+package evsrc
+
+// A Transform rewrites an Event as it passes through a stream. It returns the
+// Event to pass on and true, or false to drop the Event entirely.
+//
+// Transforms must not modify the Data of the Event they are given in place,
+// since it may be shared; allocate a new slice instead.
+type Transform func(Event) (Event, bool)
+
+// Chain returns a Transform that applies each of ts in order, stopping as soon
+// as one drops the Event.
+func Chain(ts ...Transform) Transform {
+	return func(e Event) (Event, bool) {
+		for _, t := range ts {
+			var ok bool
+			e, ok = t(e)
+			if !ok {
+				return Event{}, false
+			}
+		}
+		return e, true
+	}
+}
+
+// Map returns a Transform that replaces every Event with f(Event).
+func Map(f func(Event) Event) Transform {
+	return func(e Event) (Event, bool) {
+		return f(e), true
+	}
+}
+
+// Filter returns a Transform that drops every Event for which keep returns
+// false.
+func Filter(keep func(Event) bool) Transform {
+	return func(e Event) (Event, bool) {
+		if !keep(e) {
+			return Event{}, false
+		}
+		return e, true
+	}
+}
+
+// RenameEvent returns a Transform that changes the Event field of Events named
+// from to to.
+func RenameEvent(from, to string) Transform {
+	return func(e Event) (Event, bool) {
+		if e.Event == from {
+			e.Event = to
+		}
+		return e, true
+	}
+}
+
+// RewriteID returns a Transform that replaces the ID of every Event with an ID
+// with f(ID). Events without an ID are passed through unchanged.
+func RewriteID(f func(id string) string) Transform {
+	return func(e Event) (Event, bool) {
+		if e.ID != "" {
+			e.ID = f(e.ID)
+		}
+		return e, true
+	}
+}
+
+// Validate returns a Transform that checks the Data of each Event with the
+// validator for its name in validators, which should return an error
+// describing why the Data is invalid. Events that fail are dropped after
+// being passed to onInvalid, if it is non-nil, so that consumers only see
+// Data matching the contract they expect. Events whose name has no validator
+// pass through unchanged.
+func Validate(validators map[string]func(data []byte) error, onInvalid func(Event, error)) Transform {
+	return func(e Event) (Event, bool) {
+		validate := validators[e.Event]
+		if validate == nil {
+			return e, true
+		}
+
+		err := validate(e.Data)
+		if err != nil {
+			if onInvalid != nil {
+				onInvalid(e, err)
+			}
+			return Event{}, false
+		}
+		return e, true
+	}
+}
@@ -0,0 +1,102 @@
+package evsrc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestTransformChain(t *testing.T) {
+	transform := Chain(
+		Filter(func(e Event) bool { return e.Event != "drop" }),
+		RenameEvent("old", "new"),
+		RewriteID(func(id string) string { return "upstream-" + id }),
+		Map(func(e Event) Event {
+			e.Data = append([]byte("prefix "), e.Data...)
+			return e
+		}),
+	)
+
+	tests := []struct {
+		in   Event
+		want Event
+		ok   bool
+	}{
+		{
+			Event{Event: "drop", Data: []byte("x")},
+			Event{},
+			false,
+		},
+		{
+			Event{Event: "old", ID: "1", Data: []byte("x")},
+			Event{Event: "new", ID: "upstream-1", Data: []byte("prefix x")},
+			true,
+		},
+		{
+			Event{Event: "other", Data: []byte("y")},
+			Event{Event: "other", Data: []byte("prefix y")},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, ok := transform(test.in)
+		if ok != test.ok || !got.Eq(test.want) {
+			t.Errorf("transform(%#v) = %#v, %v, but wanted %#v, %v",
+				test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTransformEmptyChain(t *testing.T) {
+	in := Event{Event: "a", Data: []byte("b")}
+	got, ok := Chain()(in)
+	if !ok || !got.Eq(in) {
+		t.Errorf("Chain()(%#v) = %#v, %v, but wanted it unchanged", in, got, ok)
+	}
+}
+
+func TestTransformValidate(t *testing.T) {
+	errNotJSON := errors.New("not JSON")
+
+	var invalid []string
+	transform := Validate(
+		map[string]func([]byte) error{
+			"json": func(data []byte) error {
+				if !json.Valid(data) {
+					return errNotJSON
+				}
+				return nil
+			},
+		},
+		func(e Event, err error) {
+			if err != errNotJSON {
+				t.Errorf("got error %v for invalid Event, wanted %v", err, errNotJSON)
+			}
+			invalid = append(invalid, string(e.Data))
+		},
+	)
+
+	tests := []struct {
+		in Event
+		ok bool
+	}{
+		{Event{Event: "json", Data: []byte(`{"a": 1}`)}, true},
+		{Event{Event: "json", Data: []byte(`{"a": `)}, false},
+		{Event{Event: "text", Data: []byte(`{"a": `)}, true},
+	}
+
+	for _, test := range tests {
+		got, ok := transform(test.in)
+		if ok != test.ok {
+			t.Errorf("transform(%v) returned ok %v, wanted %v", test.in, ok, test.ok)
+		}
+		if ok && !got.Eq(test.in) {
+			t.Errorf("transform(%v) = %v, wanted it unchanged", test.in, got)
+		}
+	}
+
+	if len(invalid) != 1 || invalid[0] != `{"a": ` {
+		t.Errorf("got invalid Events %q, wanted only the truncated JSON", invalid)
+	}
+}